@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+const (
+	ARPPacketLen        = 28
+	ARPOperationRequest = 1
+	ARPOperationReply   = 2
+)
+
+// ARP packet for IPv4 over ethernet, RFC 826
+type ARPPacket struct {
+	HardwareType uint16
+	ProtocolType uint16
+	HardwareLen  uint8
+	ProtocolLen  uint8
+	Operation    uint16
+	SenderMac    [6]byte
+	SenderIP     [4]byte
+	TargetMac    [6]byte
+	TargetIP     [4]byte
+}
+
+// Constructor for an ARP request for target, the target MAC address is unknown
+func NewARPRequest(src net.HardwareAddr, srcIP, target net.IP) *ARPPacket {
+	p := &ARPPacket{
+		HardwareType: 1,
+		ProtocolType: 0x0800,
+		HardwareLen:  6,
+		ProtocolLen:  4,
+		Operation:    ARPOperationRequest,
+	}
+	copy(p.SenderMac[:], src)
+	copy(p.SenderIP[:], srcIP.To4())
+	copy(p.TargetIP[:], target.To4())
+	return p
+}
+
+func (p *ARPPacket) String() string {
+	return fmt.Sprintf("Operation: %d, Sender: %s at %s, Target: %s at %s", p.Operation, net.IP(p.SenderIP[:]), net.HardwareAddr(p.SenderMac[:]),
+		net.IP(p.TargetIP[:]), net.HardwareAddr(p.TargetMac[:]))
+}
+
+// A gratuitous ARP announces the address of the sender, sender and target address are the same
+func (p *ARPPacket) IsGratuitous() bool {
+	return p.SenderIP == p.TargetIP
+}
+
+// An ARP probe of address conflict detection is sent from 0.0.0.0, RFC 5227 section 2.1.1
+func (p *ARPPacket) IsProbe() bool {
+	return p.Operation == ARPOperationRequest && net.IP(p.SenderIP[:]).Equal(net.IPv4zero)
+}
+
+// Get bytes from struct
+func (p *ARPPacket) Marshal() []byte {
+	var buffer bytes.Buffer
+	err := binary.Write(&buffer, binary.BigEndian, p)
+	if err != nil {
+		panic(err)
+	}
+	return buffer.Bytes()
+}
+
+// Parse an ARP packet, ethernet padding is ignored
+func ARPPacketParse(b []byte) (*ARPPacket, error) {
+	if len(b) < ARPPacketLen {
+		return nil, errors.New("Packet is to short")
+	}
+	p := new(ARPPacket)
+	err := binary.Read(bytes.NewReader(b[:ARPPacketLen]), binary.BigEndian, p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate a received ARP packet, only requests and replies for IPv4 over ethernet are accepted
+func ARPValidatePacket(b []byte) (*ARPPacket, error) {
+	p, err := ARPPacketParse(b)
+	if err != nil {
+		return nil, err
+	}
+	if p.HardwareType != 1 || p.HardwareLen != 6 {
+		return nil, fmt.Errorf("hardware type is %d with length %d, not ethernet", p.HardwareType, p.HardwareLen)
+	}
+	if p.ProtocolType != 0x0800 || p.ProtocolLen != 4 {
+		return nil, fmt.Errorf("protocol type is %#04x with length %d, not IPv4", p.ProtocolType, p.ProtocolLen)
+	}
+	if p.Operation != ARPOperationRequest && p.Operation != ARPOperationReply {
+		return nil, fmt.Errorf("operation is %d, neither request nor reply", p.Operation)
+	}
+	// the sender MAC address is what the packet announces
+	if p.SenderMac[0]&0x01 != 0 || p.SenderMac == [6]byte{} {
+		return nil, fmt.Errorf("sender MAC address %s is no unicast address", net.HardwareAddr(p.SenderMac[:]))
+	}
+	return p, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestARPPacket(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	p := NewARPRequest(mac, net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"))
+	b := p.Marshal()
+	if len(b) != ARPPacketLen {
+		t.Fatalf("Marshaled packet has length %d", len(b))
+	}
+	// ethernet padding
+	q, err := ARPValidatePacket(append(b, make([]byte, 18)...))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if *q != *p {
+		t.Error("Unmarshaled packet differs")
+	}
+	if q.IsGratuitous() || q.IsProbe() {
+		t.Error("Request is reported as gratuitous or probe")
+	}
+	probe := NewARPRequest(mac, net.IPv4zero, net.ParseIP("10.0.0.2"))
+	if !probe.IsProbe() {
+		t.Error("Probe is not reported")
+	}
+	announcement := NewARPRequest(mac, net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.2"))
+	if !announcement.IsGratuitous() {
+		t.Error("Gratuitous ARP is not reported")
+	}
+	tests := map[string]func(p *ARPPacket){
+		"hardware type":    func(p *ARPPacket) { p.HardwareType = 6 },
+		"protocol type":    func(p *ARPPacket) { p.ProtocolType = 0x86DD },
+		"operation":        func(p *ARPPacket) { p.Operation = 3 },
+		"multicast sender": func(p *ARPPacket) { p.SenderMac[0] = 0x01 },
+	}
+	for name, change := range tests {
+		q := *p
+		change(&q)
+		if _, err := ARPValidatePacket(q.Marshal()); err == nil {
+			t.Errorf("Invalid %s was accepted", name)
+		}
+	}
+	if _, err := ARPValidatePacket(b[:20]); err == nil {
+		t.Error("Truncated packet was accepted")
+	}
+}
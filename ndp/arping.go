@@ -0,0 +1,79 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"grnvs/pcap"
+	"net"
+	"os"
+	"time"
+)
+
+// Build the ethernet frame of an ARP request for target, broadcast unless dMac is a known MAC address
+func buildARPRequest(iface *net.Interface, src net.IP, dMac net.HardwareAddr, target net.IP) []byte {
+	eFrame := NewEthernetFrame(0x0806, iface.HardwareAddr, dMac)
+	return append(eFrame.Marshal(), NewARPRequest(iface.HardwareAddr, src, target).Marshal()...)
+}
+
+// Read ARP packets from f forever and pass the replies and gratuitous ARPs of target to dataIn. In dad mode the
+// probes of others for target are passed as well.
+func receiveARP(f *os.File, iface *net.Interface, target net.IP, dad, verbose bool, dataIn chan<- *answer) {
+	for {
+		b := make([]byte, 1500)
+		numRead, err := f.Read(b)
+		if err != nil {
+			panic(err)
+		}
+		received := time.Now()
+		if numRead < EthernetFrameLen {
+			continue
+		}
+		eFrame, err := EthernetFrameParse(b[:EthernetFrameLen])
+		if err != nil || eFrame.Ethertype != 0x0806 || bytes.Equal(eFrame.SrcMac[:], iface.HardwareAddr) {
+			continue
+		}
+		broadcast := eFrame.DstMac == [6]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+		if !broadcast && !bytes.Equal(eFrame.DstMac[:], iface.HardwareAddr) {
+			continue
+		}
+		record(iface.Name, b[:numRead], pcap.Inbound)
+		p, err := ARPValidatePacket(b[EthernetFrameLen:numRead])
+		if err != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped ARP packet from %s: %s\n", net.HardwareAddr(eFrame.SrcMac[:]), err.Error())
+			}
+			continue
+		}
+		sender := net.IP(p.SenderIP[:])
+		switch {
+		case sender.Equal(target) && (p.Operation == ARPOperationReply || p.IsGratuitous()):
+		case dad && p.IsProbe() && net.IP(p.TargetIP[:]).Equal(target):
+			// a competing probe
+		default:
+			// address resolution of others
+			continue
+		}
+		dataIn <- &answer{
+			ARP:      p,
+			EtherSrc: net.HardwareAddr(append([]byte(nil), eFrame.SrcMac[:]...)),
+			Time:     received,
+		}
+	}
+}
+
+// Get the first IPv4 address of the interface, nil if it has none
+func getSrcAddr4(iface *net.Interface) net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		panic(err)
+	}
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err == nil && ip.To4() != nil {
+			return ip.To4()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An IPv6 address and the MAC address it was last seen with
+type binding struct {
+	IP        net.IP
+	Mac       net.HardwareAddr
+	FirstSeen time.Time // first seen with Mac
+	LastSeen  time.Time
+}
+
+// Suspicious or new binding seen by the detector
+type ndpEvent struct {
+	Time  time.Time
+	Event string // new-station, flip-flop, override or tlla-mismatch
+	IP    net.IP
+	Mac   net.HardwareAddr
+	Text  string
+}
+
+func (e *ndpEvent) String() string {
+	s := fmt.Sprintf("%s %s: %s at %s", e.Time.Format(time.RFC3339), e.Event, e.IP, e.Mac)
+	if e.Text != "" {
+		s += " " + e.Text
+	}
+	return s
+}
+
+// Bindings that were not seen for this long are forgotten
+const bindingForgetAfter = 30 * 24 * time.Hour
+
+// Upper bound of remembered bindings, a flood of advertisements from spoofed addresses must not exhaust memory
+const bindingsMax = 16384
+
+// Detects NDP spoofing by keeping every IPv6-to-MAC binding seen in NS, NA, RS and RA messages
+type detector struct {
+	bindings map[string]*binding
+	// bindings changed since the last save
+	changed bool
+	// only last seen times changed
+	touched bool
+	// last sweep for forgotten bindings
+	lastExpire time.Time
+}
+
+func newDetector() *detector {
+	return &detector{
+		bindings: make(map[string]*binding),
+	}
+}
+
+// Load the bindings of a previous run, a missing file is an empty table.
+// One binding per line: <ip> <mac> <first seen> <last seen>, times in RFC 3339.
+func loadDetector(name string) (*detector, error) {
+	d := newDetector()
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return d, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		b, err := parseBinding(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, line, err.Error())
+		}
+		d.bindings[b.IP.String()] = b
+	}
+	return d, scanner.Err()
+}
+
+func parseBinding(fields []string) (*binding, error) {
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("expected <ip> <mac> <first seen> <last seen>")
+	}
+	b := &binding{
+		IP: net.ParseIP(fields[0]),
+	}
+	if b.IP == nil {
+		return nil, fmt.Errorf("%s is no valid IP address", fields[0])
+	}
+	var err error
+	if b.Mac, err = net.ParseMAC(fields[1]); err != nil {
+		return nil, err
+	}
+	if b.FirstSeen, err = time.Parse(time.RFC3339, fields[2]); err != nil {
+		return nil, err
+	}
+	if b.LastSeen, err = time.Parse(time.RFC3339, fields[3]); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Write the bindings sorted by address, the file is replaced atomically
+func (d *detector) Save(name string) error {
+	keys := make([]string, 0, len(d.bindings))
+	for key := range d.bindings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "# <ip> <mac> <first seen> <last seen>")
+	for _, key := range keys {
+		b := d.bindings[key]
+		fmt.Fprintf(w, "%s %s %s %s\n", b.IP, b.Mac, b.FirstSeen.Format(time.RFC3339), b.LastSeen.Format(time.RFC3339))
+	}
+	err = w.Flush()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	d.changed = false
+	d.touched = false
+	return nil
+}
+
+// Forget the bindings that were not seen for bindingForgetAfter, at most once per hour unless the table is full.
+// If there are still too many, the least recently seen quarter is dropped so that a flood does not cost a sweep
+// per message.
+func (d *detector) expire(now time.Time) {
+	if now.Sub(d.lastExpire) < time.Hour && len(d.bindings) < bindingsMax {
+		return
+	}
+	d.lastExpire = now
+	var kept []*binding
+	for key, b := range d.bindings {
+		if !b.LastSeen.Add(bindingForgetAfter).After(now) {
+			delete(d.bindings, key)
+			d.changed = true
+		} else {
+			kept = append(kept, b)
+		}
+	}
+	if len(kept) < bindingsMax {
+		return
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].LastSeen.Before(kept[j].LastSeen) })
+	for _, b := range kept[:len(kept)-bindingsMax*3/4] {
+		delete(d.bindings, b.IP.String())
+	}
+	d.changed = true
+}
+
+// Remember that ip was seen with mac
+func (d *detector) observe(ip net.IP, mac net.HardwareAddr, now time.Time) *ndpEvent {
+	b, ok := d.bindings[ip.String()]
+	if ok && !b.LastSeen.Add(bindingForgetAfter).After(now) {
+		ok = false
+	}
+	if !ok {
+		d.expire(now)
+		d.bindings[ip.String()] = &binding{
+			IP:        ip,
+			Mac:       mac,
+			FirstSeen: now,
+			LastSeen:  now,
+		}
+		d.changed = true
+		return &ndpEvent{Time: now, Event: "new-station", IP: ip, Mac: mac}
+	}
+	b.LastSeen = now
+	d.touched = true
+	if bytes.Equal(b.Mac, mac) {
+		return nil
+	}
+	old := b.Mac
+	b.Mac = mac
+	b.FirstSeen = now
+	d.changed = true
+	return &ndpEvent{Time: now, Event: "flip-flop", IP: ip, Mac: mac, Text: fmt.Sprintf("(was %s)", old)}
+}
+
+// Check a received NDP message b and return the events it causes
+func (d *detector) Check(etherSrc net.HardwareAddr, header *IPv6Header, b []byte, now time.Time) ([]*ndpEvent, error) {
+	var events []*ndpEvent
+	observe := func(ip net.IP, mac net.HardwareAddr) {
+		// duplicate address detection and router solicitations may come from ::
+		if ip.IsUnspecified() {
+			return
+		}
+		if e := d.observe(ip, mac, now); e != nil {
+			events = append(events, e)
+		}
+	}
+	switch b[0] {
+	case 0x85:
+		rs, err := ICMPv6ValidateRouterSolicitation(header, b)
+		if err != nil {
+			return nil, err
+		}
+		observe(header.Src, orMac(rs.SourceLinkAddress(), etherSrc))
+	case 0x86:
+		ra, err := ICMPv6ValidateRouterAdvertisement(header, b)
+		if err != nil {
+			return nil, err
+		}
+		observe(header.Src, orMac(ra.SourceLinkAddress(), etherSrc))
+	case 0x87:
+		ns, err := ICMPv6ValidateNeighborSolicitation(header, b)
+		if err != nil {
+			return nil, err
+		}
+		observe(header.Src, orMac(ns.SourceLinkAddress(), etherSrc))
+	case 0x88:
+		na, err := ICMPv6ValidateNeighborAdvertisement(header, b)
+		if err != nil {
+			return nil, err
+		}
+		target := net.IP(na.TargetAddress[:])
+		tlla := na.TargetLinkAddress()
+		// proxies answer for others, but usually the sender announces itself
+		if tlla != nil && !bytes.Equal(tlla, etherSrc) {
+			events = append(events, &ndpEvent{Time: now, Event: "tlla-mismatch", IP: target, Mac: tlla,
+				Text: fmt.Sprintf("(ethernet source %s)", etherSrc)})
+		}
+		mac := orMac(tlla, etherSrc)
+		// an unsolicited override takes the address away from its owner, it is reported instead of the flip-flop
+		if owner, ok := d.bindings[target.String()]; ok && !bytes.Equal(owner.Mac, mac) &&
+			!na.FlagSet(ICMPv6NeighborAdvertisementFlagS) && na.FlagSet(ICMPv6NeighborAdvertisementFlagO) {
+			events = append(events, &ndpEvent{Time: now, Event: "override", IP: target, Mac: mac,
+				Text: fmt.Sprintf("(unsolicited override of %s)", owner.Mac)})
+			d.observe(target, mac, now)
+			break
+		}
+		observe(target, mac)
+	default:
+		return nil, fmt.Errorf("ICMPv6 type %d is no NDP message", b[0])
+	}
+	return events, nil
+}
+
+// The link-layer address option if present, the ethernet source otherwise
+func orMac(option, etherSrc net.HardwareAddr) net.HardwareAddr {
+	if option != nil {
+		return option
+	}
+	return etherSrc
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDetectorObserve(t *testing.T) {
+	d := newDetector()
+	ip := net.ParseIP("fd01::2")
+	a, _ := net.ParseMAC("02:00:00:00:00:01")
+	b, _ := net.ParseMAC("02:00:00:00:00:02")
+	now := time.Now()
+	tests := []struct {
+		mac      net.HardwareAddr
+		expected string
+	}{
+		{a, "new-station"},
+		{a, ""},
+		{b, "flip-flop"},
+		{a, "flip-flop"},
+	}
+	for i, test := range tests {
+		e := d.observe(ip, test.mac, now)
+		if e == nil && test.expected != "" || e != nil && e.Event != test.expected {
+			t.Errorf("%d: expected event %q, got %v", i, test.expected, e)
+		}
+	}
+}
+
+func TestDetectorSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ndpmon")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "state")
+	d, err := loadDetector(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	now := time.Now().Truncate(time.Second)
+	d.observe(net.ParseIP("fd01::2"), mac, now)
+	d.observe(net.ParseIP("fe80::1"), mac, now)
+	if err := d.Save(name); err != nil {
+		t.Fatal(err.Error())
+	}
+	d, err = loadDetector(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(d.bindings) != 2 {
+		t.Fatalf("Expected 2 bindings, got %d", len(d.bindings))
+	}
+	b := d.bindings["fd01::2"]
+	if b == nil || b.Mac.String() != mac.String() || !b.FirstSeen.Equal(now) || !b.LastSeen.Equal(now) {
+		t.Error("Loaded binding differs")
+	}
+	if e := d.observe(net.ParseIP("fd01::2"), mac, now); e != nil {
+		t.Errorf("Known binding caused %s", e.Event)
+	}
+}
+
+func TestDetectorExpire(t *testing.T) {
+	d := newDetector()
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	ip := net.ParseIP("fd01::2")
+	now := time.Now()
+	d.observe(ip, mac, now)
+	if e := d.observe(ip, mac, now.Add(bindingForgetAfter-time.Second)); e != nil {
+		t.Errorf("Binding was forgotten too early, got %s", e.Event)
+	}
+	if e := d.observe(ip, mac, now.Add(2*bindingForgetAfter)); e == nil || e.Event != "new-station" {
+		t.Errorf("Binding was not forgotten, got %v", e)
+	}
+	// spoofed sources are capped
+	for i := 0; i < 2*bindingsMax; i++ {
+		ip := net.IP{0xfd, 0x02, 14: byte(i >> 8), 15: byte(i)}
+		d.observe(ip, mac, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if len(d.bindings) > bindingsMax || d.bindings["fd02::"+fmt.Sprintf("%x", 2*bindingsMax-1)] == nil {
+		t.Errorf("%d bindings remembered", len(d.bindings))
+	}
+}
+
+func TestDetectorCheck(t *testing.T) {
+	owner, _ := net.ParseMAC("02:00:00:00:00:01")
+	spoofer, _ := net.ParseMAC("02:00:00:00:00:02")
+	// a neighbor advertisement for fd01::2 with flags and target link-layer address
+	advertisement := func(flags uint8, tlla net.HardwareAddr) (*IPv6Header, []byte) {
+		m := ICMPv6NeighborAdvertisement{
+			Header:  ICMPv6MessageHeader{Type: 0x88},
+			Options: []ICMPv6Option{&ICMPv6LinkAddressOption{OptionType: ICMPv6OptionTargetLinkAddress, Addr: tlla}},
+		}
+		m.SetFlags(flags)
+		copy(m.TargetAddress[:], net.ParseIP("fd01::2"))
+		b := m.Marshal()
+		h := &IPv6Header{
+			PayloadLen: len(b),
+			NextHeader: 0x3a,
+			HopLimit:   255,
+			Src:        net.ParseIP("fd01::2"),
+			Dst:        net.ParseIP("ff02::1"),
+		}
+		binary.BigEndian.PutUint16(b[2:4], ICMPv6Checksum(*h, b))
+		return h, b
+	}
+	events := func(events []*ndpEvent) string {
+		s := ""
+		for _, e := range events {
+			s += e.Event + " "
+		}
+		return s
+	}
+	d := newDetector()
+	tests := []struct {
+		flags    uint8
+		etherSrc net.HardwareAddr
+		tlla     net.HardwareAddr
+		expected string
+	}{
+		{ICMPv6NeighborAdvertisementFlagO, owner, owner, "new-station "},
+		{ICMPv6NeighborAdvertisementFlagO, owner, owner, ""},
+		// another station claims the address without being asked
+		{ICMPv6NeighborAdvertisementFlagO, spoofer, spoofer, "override "},
+		// without override flag the change is a flip-flop
+		{0, owner, owner, "flip-flop "},
+		// the sender announces another station
+		{0, spoofer, owner, "tlla-mismatch "},
+		{ICMPv6NeighborAdvertisementFlagO, spoofer, spoofer, "override "},
+		{ICMPv6NeighborAdvertisementFlagO, owner, spoofer, "tlla-mismatch "},
+	}
+	for i, test := range tests {
+		h, b := advertisement(test.flags, test.tlla)
+		e, err := d.Check(test.etherSrc, h, b, time.Now())
+		if err != nil {
+			t.Fatalf("%d: %s", i, err.Error())
+		}
+		if s := events(e); s != test.expected {
+			t.Errorf("%d: expected events %q, got %q", i, test.expected, s)
+		}
+	}
+}
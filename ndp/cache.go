@@ -0,0 +1,122 @@
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"grnvs/neighbor"
+	"grnvs/pcap"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Sends the neighbor solicitations of a neighbor cache on a raw socket
+type socketTransport struct {
+	iface  *net.Interface
+	src    net.IP
+	socket int
+}
+
+func (t *socketTransport) Solicit(target net.IP, mac net.HardwareAddr) error {
+	dst := target
+	if mac == nil {
+		dst = SolicitedNodeAddress(target)
+		mac = MulticastMac(dst)
+	}
+	data := buildSolicitation(t.iface, t.src, dst, mac, target)
+	if _, err := syscall.Write(t.socket, data); err != nil {
+		return err
+	}
+	record(t.iface.Name, data, pcap.Outbound)
+	return nil
+}
+
+// Pass received neighbor solicitations and advertisements to the cache
+func feedCache(f *os.File, iface *net.Interface, verbose bool, cache *neighbor.Cache) {
+	readICMPv6(f, iface, verbose, []byte{0x87, 0x88}, func(etherSrc net.HardwareAddr, header *IPv6Header, b []byte) {
+		if b[0] == 0x87 {
+			ns, err := ICMPv6ValidateNeighborSolicitation(header, b)
+			if err == nil {
+				cache.HandleSolicitation(header.Src, ns.SourceLinkAddress())
+				return
+			}
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped neighbor solicitation from %s: %s\n", header.Src, err.Error())
+			}
+			return
+		}
+		na, err := ICMPv6ValidateNeighborAdvertisement(header, b)
+		if err != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped neighbor advertisement from %s: %s\n", header.Src, err.Error())
+			}
+			return
+		}
+		cache.HandleAdvertisement(net.IP(na.TargetAddress[:]), na.TargetLinkAddress(),
+			na.FlagSet(ICMPv6NeighborAdvertisementFlagS), na.FlagSet(ICMPv6NeighborAdvertisementFlagO),
+			na.FlagSet(ICMPv6NeighborAdvertisementFlagR))
+	})
+}
+
+// Resolve the addresses read from stdin, one per line, through a neighbor cache. State changes are printed in
+// verbose mode. Returns exitNoAnswer if an address could not be resolved.
+func cacheMode(iface *net.Interface, src net.IP, verbose bool) int {
+	socket, err := openPacketSocket(iface)
+	if err != nil {
+		panic(err)
+	}
+	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
+	defer f.Close()
+
+	cache := neighbor.New(&socketTransport{iface: iface, src: src, socket: socket}, nil)
+	defer cache.Close()
+	if verbose {
+		cache.OnStateChange(func(e neighbor.Entry, old neighbor.State, removed bool) {
+			if removed {
+				fmt.Fprintf(os.Stderr, "%s %s removed\n", e.IP, e.State)
+				return
+			}
+			if old == e.State {
+				// new entry
+				fmt.Fprintf(os.Stderr, "%s %s %s\n", e.IP, e.State, e.Mac)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%s %s -> %s %s\n", e.IP, old, e.State, e.Mac)
+		})
+	}
+	go feedCache(f, iface, verbose, cache)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	code := exitResolved
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil || ip.To4() != nil {
+			fmt.Fprintf(os.Stderr, "%s is no valid IPv6 address.\n", s)
+			continue
+		}
+		wg.Add(1)
+		cache.Resolve(ip, func(mac net.HardwareAddr, err error) {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Printf("%s: %s\n", ip, err.Error())
+				code = exitNoAnswer
+				return
+			}
+			fmt.Printf("%s is at %s\n", ip, mac)
+		})
+	}
+	wg.Wait()
+	return code
+}
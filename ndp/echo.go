@@ -0,0 +1,134 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"grnvs/pcap"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Send echo requests to ff02::1, and to ff02::2 if routers is set, from every IPv6 address of the interface, so
+// that the hosts answer from their link-local and from their global addresses. The requests are repeated tries
+// times spaced by retransTimer. Every echo reply received until timeout is recorded with the ethernet source of
+// its frame. Prints the addresses per MAC address and returns exitNoAnswer if no host answered.
+func echoDiscovery(iface *net.Interface, routers bool, timeout time.Duration, tries int, retransTimer time.Duration, dryRun, verbose bool) int {
+	groups := []net.IP{net.ParseIP("ff02::1")}
+	if routers {
+		groups = append(groups, net.ParseIP("ff02::2"))
+	}
+	var sources []net.IP
+	addrs, err := iface.Addrs()
+	if err != nil {
+		panic(err)
+	}
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err == nil && ip.To4() == nil && !ip.IsLoopback() {
+			sources = append(sources, ip)
+		}
+	}
+	if len(sources) == 0 {
+		fmt.Fprintf(os.Stderr, "The network interface %s has no IPv6 address.\n", iface.Name)
+		return exitNoAnswer
+	}
+
+	id := uint16(os.Getpid())
+	var seq uint16
+	request := func(src, dst net.IP) []byte {
+		seq++
+		m := ICMPv6Echo{
+			Header:     ICMPv6MessageHeader{Type: 0x80},
+			Identifier: id,
+			Sequence:   seq,
+		}
+		ipHeader := IPv6Header{
+			Version:    0x6,
+			PayloadLen: len(m.Marshal()),
+			NextHeader: 0x3a,
+			HopLimit:   1,
+			Src:        src,
+			Dst:        dst,
+		}
+		m.Header.Checksum = ICMPv6Checksum(ipHeader, m.Marshal())
+		data := append(NewEthernetFrame(0x86DD, iface.HardwareAddr, MulticastMac(dst)).Marshal(), ipHeader.Marshal()...)
+		return append(data, m.Marshal()...)
+	}
+	// Only record the frames
+	if dryRun {
+		for _, group := range groups {
+			for _, src := range sources {
+				record(iface.Name, request(src, group), pcap.Outbound)
+			}
+		}
+		return exitResolved
+	}
+
+	socket, err := openPacketSocket(iface)
+	if err != nil {
+		panic(err)
+	}
+	send := func() {
+		for _, group := range groups {
+			for _, src := range sources {
+				data := request(src, group)
+				if _, err := syscall.Write(socket, data); err != nil {
+					panic(err)
+				}
+				record(iface.Name, data, pcap.Outbound)
+			}
+		}
+	}
+	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
+	defer f.Close()
+
+	type reply struct {
+		src      net.IP
+		etherSrc net.HardwareAddr
+	}
+	dataIn := make(chan *reply, 16)
+	go readICMPv6(f, iface, verbose, []byte{0x81}, func(etherSrc net.HardwareAddr, header *IPv6Header, b []byte) {
+		m, err := ICMPv6ValidateEchoReply(header, b)
+		if err != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped echo reply from %s: %s\n", header.Src, err.Error())
+			}
+			return
+		}
+		// replies to other programs
+		if m.Identifier != id {
+			return
+		}
+		dataIn <- &reply{src: header.Src, etherSrc: etherSrc}
+	})
+
+	hosts := newInventory()
+	send()
+	retransmit := time.NewTicker(retransTimer)
+	defer retransmit.Stop()
+	sent := 1
+	timedout := time.After(timeout)
+	for {
+		select {
+		case r := <-dataIn:
+			if hosts.Add(r.etherSrc, r.src) && verbose {
+				fmt.Fprintf(os.Stderr, "%s is at %s\n", r.src, r.etherSrc)
+			}
+		case <-retransmit.C:
+			if sent < tries {
+				send()
+				sent++
+			}
+		case <-timedout:
+			if hosts.Len() == 0 {
+				fmt.Println("No echo reply received")
+				return exitNoAnswer
+			}
+			hosts.Print(os.Stdout)
+			return exitResolved
+		}
+	}
+}
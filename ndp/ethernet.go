@@ -26,7 +26,7 @@ func NewEthernetFrame(eType uint16, src net.HardwareAddr, dst net.HardwareAddr)
 	copy(frame.DstMac[:], dst[0:6])
 	copy(frame.SrcMac[:], src[0:6])
 	// Ethertype
-	frame.Ethertype = 0x86DD
+	frame.Ethertype = eType
 
 	return frame
 }
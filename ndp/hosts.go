@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+)
+
+// The addresses that answered an echo request, by the MAC address of their frames
+type inventory struct {
+	hosts map[string][]net.IP
+}
+
+func newInventory() *inventory {
+	return &inventory{
+		hosts: make(map[string][]net.IP),
+	}
+}
+
+// Remember that ip answered from mac, returns false if this was already known
+func (inv *inventory) Add(mac net.HardwareAddr, ip net.IP) bool {
+	key := mac.String()
+	for _, known := range inv.hosts[key] {
+		if known.Equal(ip) {
+			return false
+		}
+	}
+	inv.hosts[key] = append(inv.hosts[key], ip)
+	return true
+}
+
+// Number of MAC addresses
+func (inv *inventory) Len() int {
+	return len(inv.hosts)
+}
+
+// Print one line per MAC address with its link-local addresses followed by the others, both sorted
+func (inv *inventory) Print(w io.Writer) {
+	macs := make([]string, 0, len(inv.hosts))
+	for mac := range inv.hosts {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	for _, mac := range macs {
+		ips := inv.hosts[mac]
+		sort.Slice(ips, func(i, j int) bool {
+			if ips[i].IsLinkLocalUnicast() != ips[j].IsLinkLocalUnicast() {
+				return ips[i].IsLinkLocalUnicast()
+			}
+			return bytes.Compare(ips[i], ips[j]) < 0
+		})
+		fmt.Fprintf(w, "%s", mac)
+		for _, ip := range ips {
+			fmt.Fprintf(w, " %s", ip)
+		}
+		fmt.Fprintln(w)
+	}
+}
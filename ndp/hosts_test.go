@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestInventory(t *testing.T) {
+	inv := newInventory()
+	a, _ := net.ParseMAC("02:00:00:00:00:0a")
+	b, _ := net.ParseMAC("02:00:00:00:00:0b")
+	if !inv.Add(b, net.ParseIP("fd01::2")) || !inv.Add(b, net.ParseIP("fe80::2")) || !inv.Add(a, net.ParseIP("fe80::1")) {
+		t.Error("New address was reported as known")
+	}
+	if inv.Add(b, net.ParseIP("fd01:0::2")) {
+		t.Error("Known address was reported as new")
+	}
+	var buffer bytes.Buffer
+	inv.Print(&buffer)
+	expected := "02:00:00:00:00:0a fe80::1\n02:00:00:00:00:0b fe80::2 fd01::2\n"
+	if inv.Len() != 2 || buffer.String() != expected {
+		t.Errorf("Inventory is\n%s", buffer.String())
+	}
+}
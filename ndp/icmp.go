@@ -5,12 +5,19 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"net"
+	"strings"
 )
 
 const (
 	ICMPv6NeighborAdvertisementFlagR uint8 = 4
 	ICMPv6NeighborAdvertisementFlagS uint8 = 2
-	ICMPv6NeighborAdvertisementFlag0 uint8 = 1
+	ICMPv6NeighborAdvertisementFlagO uint8 = 1
+)
+
+const (
+	ICMPv6RouterAdvertisementFlagM uint8 = 0x80 // managed address configuration
+	ICMPv6RouterAdvertisementFlagO uint8 = 0x40 // other configuration
 )
 
 // ICMPv6 base header (4 byte)
@@ -20,52 +27,162 @@ type ICMPv6MessageHeader struct {
 	Checksum uint16
 }
 
-// ICMPv6 neighbor solicitation message (request) (4 byte + 28 byte)
+// ICMPv6 neighbor solicitation message (request) (4 byte + 20 byte + options)
 type ICMPv6NeighborSolicitation struct {
-	Header            ICMPv6MessageHeader
-	Reserved          uint32
-	TargetAddress     [16]byte
-	OptionType        byte
-	OptionLength      byte
-	SourceLinkAddress [6]byte
+	Header        ICMPv6MessageHeader
+	Reserved      uint32
+	TargetAddress [16]byte
+	Options       []ICMPv6Option
+}
+
+// ICMPv6 router solicitation message (4 byte + 4 byte + options)
+type ICMPv6RouterSolicitation struct {
+	Header   ICMPv6MessageHeader
+	Reserved uint32
+	Options  []ICMPv6Option
+}
+
+// ICMPv6 router advertisement message (4 byte + 12 byte + options)
+type ICMPv6RouterAdvertisement struct {
+	Header         ICMPv6MessageHeader
+	CurHopLimit    uint8
+	Flags          uint8 // M, O and 2 bit router preference
+	RouterLifetime uint16
+	ReachableTime  uint32
+	RetransTimer   uint32
+	Options        []ICMPv6Option
+}
+
+// ICMPv6 echo request or reply message (4 byte + 4 byte + data), RFC 4443 section 4
+type ICMPv6Echo struct {
+	Header     ICMPv6MessageHeader
+	Identifier uint16
+	Sequence   uint16
+	Data       []byte
 }
 
 // IMCPv6 neighbor advertisement message (response)
 type ICMPv6NeighborAdvertisement struct {
-	Header            ICMPv6MessageHeader
-	Flags             uint32 // 3 bit flags + 29 bit reserved
-	TargetAddress     [16]byte
-	OptionType        byte
-	OptionLength      byte
-	SourceLinkAddress [6]byte
+	Header        ICMPv6MessageHeader
+	Flags         uint32 // 3 bit flags + 29 bit reserved
+	TargetAddress [16]byte
+	Options       []ICMPv6Option
 }
 
+// Test one of the R, S and O flags
 func (m *ICMPv6NeighborAdvertisement) FlagSet(flag uint8) bool {
-	return uint8(m.Flags>>29)&flag == 1
+	return uint8(m.Flags>>29)&flag != 0
+}
+
+// Get the target link-layer address option, nil if the message has none
+func (m *ICMPv6NeighborAdvertisement) TargetLinkAddress() net.HardwareAddr {
+	return findLinkAddress(m.Options, ICMPv6OptionTargetLinkAddress)
 }
 
 func (m *ICMPv6NeighborAdvertisement) String() string {
 	if m == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("Header-Type: %x, Header-Code: %x, Header-Checksum: %x, Target-Address: %x, Option-Type: %x, Option-Length: %x, Source-Link-Address: %x", m.Header.Type, m.Header.Code, m.Header.Checksum, m.TargetAddress, m.OptionType, m.OptionLength, m.SourceLinkAddress)
+	opts := make([]string, len(m.Options))
+	for i, o := range m.Options {
+		opts[i] = o.String()
+	}
+	return fmt.Sprintf("Header-Type: %x, Header-Code: %x, Header-Checksum: %x, Target-Address: %x, Options: [%s]", m.Header.Type, m.Header.Code, m.Header.Checksum, m.TargetAddress, strings.Join(opts, "; "))
+}
+
+// Set the R, S and O flags
+func (m *ICMPv6NeighborAdvertisement) SetFlags(flags uint8) {
+	m.Flags = uint32(flags&0x07) << 29
+}
+
+// Convert the struct to a byte slice
+func (m *ICMPv6NeighborAdvertisement) Marshal() []byte {
+	var buffer bytes.Buffer
+	// fixed part, followed by the options
+	for _, v := range []interface{}{m.Header, m.Flags, m.TargetAddress} {
+		err := binary.Write(&buffer, binary.BigEndian, v)
+		if err != nil {
+			panic(err)
+		}
+	}
+	buffer.Write(ICMPv6MarshalOptions(m.Options))
+	return buffer.Bytes()
+}
+
+// Get the source link-layer address option, nil if the message has none
+func (m *ICMPv6RouterSolicitation) SourceLinkAddress() net.HardwareAddr {
+	return findLinkAddress(m.Options, ICMPv6OptionSourceLinkAddress)
+}
+
+// Convert the struct to a byte slice
+func (m *ICMPv6RouterSolicitation) Marshal() []byte {
+	var buffer bytes.Buffer
+	// fixed part, followed by the options
+	for _, v := range []interface{}{m.Header, m.Reserved} {
+		err := binary.Write(&buffer, binary.BigEndian, v)
+		if err != nil {
+			panic(err)
+		}
+	}
+	buffer.Write(ICMPv6MarshalOptions(m.Options))
+	return buffer.Bytes()
+}
+
+// Get the source link-layer address option, nil if the message has none
+func (m *ICMPv6RouterAdvertisement) SourceLinkAddress() net.HardwareAddr {
+	return findLinkAddress(m.Options, ICMPv6OptionSourceLinkAddress)
+}
+
+// Default router preference, RFC 4191 section 2.2
+func (m *ICMPv6RouterAdvertisement) Preference() uint8 {
+	return (m.Flags >> 3) & 0x03
+}
+
+func (m *ICMPv6RouterAdvertisement) String() string {
+	if m == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("Hop-Limit: %d, Managed: %t, Other: %t, Preference: %s, Router-Lifetime: %ds, Reachable-Time: %dms, Retrans-Timer: %dms",
+		m.CurHopLimit, m.Flags&ICMPv6RouterAdvertisementFlagM != 0, m.Flags&ICMPv6RouterAdvertisementFlagO != 0, RouterPreference(m.Preference()),
+		m.RouterLifetime, m.ReachableTime, m.RetransTimer)
+}
+
+// Get the source link-layer address option, nil if the message has none
+func (m *ICMPv6NeighborSolicitation) SourceLinkAddress() net.HardwareAddr {
+	return findLinkAddress(m.Options, ICMPv6OptionSourceLinkAddress)
 }
 
 // Convert the struct to a byte slice
 func (m *ICMPv6NeighborSolicitation) Marshal() []byte {
 	var buffer bytes.Buffer
-	err := binary.Write(&buffer, binary.BigEndian, m)
-	if err != nil {
-		panic(err)
+	// fixed part, followed by the options
+	for _, v := range []interface{}{m.Header, m.Reserved, m.TargetAddress} {
+		err := binary.Write(&buffer, binary.BigEndian, v)
+		if err != nil {
+			panic(err)
+		}
 	}
+	buffer.Write(ICMPv6MarshalOptions(m.Options))
+	return buffer.Bytes()
+}
+
+// Convert the struct to a byte slice
+func (m *ICMPv6Echo) Marshal() []byte {
+	var buffer bytes.Buffer
+	// fixed part, followed by the data
+	for _, v := range []interface{}{m.Header, m.Identifier, m.Sequence} {
+		err := binary.Write(&buffer, binary.BigEndian, v)
+		if err != nil {
+			panic(err)
+		}
+	}
+	buffer.Write(m.Data)
 	return buffer.Bytes()
 }
 
 // ICMPv6 Checksum calculation
 // Adapted from https://github.com/golang/net/blob/bdcab5d1425b3bc74ab0f2be70acb9e4a2b2f73e/icmp/message.go#L35
-func ICMPv6Checksum(ipHeader IPv6Header, icmpPayload ICMPv6NeighborSolicitation) uint16 {
-	// get icmp payload bytes
-	b := icmpPayload.Marshal()
+func ICMPv6Checksum(ipHeader IPv6Header, b []byte) uint16 {
 	// make pseudo header
 	pHeader := IPv6PseudoHeader{
 		Length:     uint32(len(b)),
@@ -93,16 +210,255 @@ func ICMPv6Checksum(ipHeader IPv6Header, icmpPayload ICMPv6NeighborSolicitation)
 	return htons(^uint16(s))
 }
 
-// This function discards neighbor advertisement without options (Because we need the targets mac address)
-func ICMPv6ParseNeighborAdvertisement(b []byte) (m *ICMPv6NeighborAdvertisement, err error) {
-	m = new(ICMPv6NeighborAdvertisement)
-	buf := bytes.NewReader(b)
-	err = binary.Read(buf, binary.BigEndian, m)
+// Verify the checksum of the icmp message b received with ipHeader
+func ICMPv6VerifyChecksum(ipHeader *IPv6Header, b []byte) bool {
+	if len(b) < 4 {
+		return false
+	}
+	// calculate the checksum with the checksum field set to zero
+	c := make([]byte, len(b))
+	copy(c, b)
+	c[2] = 0
+	c[3] = 0
+	return ICMPv6Checksum(*ipHeader, c) == binary.BigEndian.Uint16(b[2:4])
+}
+
+// Validate a received neighbor advertisement as described in RFC 4861 section 7.1.2
+func ICMPv6ValidateNeighborAdvertisement(ipHeader *IPv6Header, b []byte) (*ICMPv6NeighborAdvertisement, error) {
+	if ipHeader.HopLimit != 255 {
+		return nil, fmt.Errorf("hop limit is %d, not 255", ipHeader.HopLimit)
+	}
+	if len(b) < 24 {
+		return nil, fmt.Errorf("ICMP length is %d, less than 24 octets", len(b))
+	}
+	if !ICMPv6VerifyChecksum(ipHeader, b) {
+		return nil, errors.New("invalid checksum")
+	}
+	if b[1] != 0 {
+		return nil, fmt.Errorf("ICMP code is %d, not 0", b[1])
+	}
+	// this also rejects options with length zero
+	m, err := ICMPv6ParseNeighborAdvertisement(b)
 	if err != nil {
 		return nil, err
-	} else if m.Header.Type != 0x88 || m.OptionType != 0x02 || m.OptionLength != 0x01 || !m.FlagSet(ICMPv6NeighborAdvertisementFlag0) {
+	}
+	if net.IP(m.TargetAddress[:]).IsMulticast() {
+		return nil, errors.New("target address is multicast")
+	}
+	if ipHeader.Dst.IsMulticast() && m.FlagSet(ICMPv6NeighborAdvertisementFlagS) {
+		return nil, errors.New("solicited flag is set for multicast destination")
+	}
+	return m, nil
+}
+
+// Validate a received router solicitation as described in RFC 4861 section 6.1.1
+func ICMPv6ValidateRouterSolicitation(ipHeader *IPv6Header, b []byte) (*ICMPv6RouterSolicitation, error) {
+	if ipHeader.HopLimit != 255 {
+		return nil, fmt.Errorf("hop limit is %d, not 255", ipHeader.HopLimit)
+	}
+	if len(b) < 8 {
+		return nil, fmt.Errorf("ICMP length is %d, less than 8 octets", len(b))
+	}
+	if !ICMPv6VerifyChecksum(ipHeader, b) {
+		return nil, errors.New("invalid checksum")
+	}
+	if b[1] != 0 {
+		return nil, fmt.Errorf("ICMP code is %d, not 0", b[1])
+	}
+	if b[0] != 0x85 {
+		return nil, errors.New("Message is no router solicitation")
+	}
+	m := &ICMPv6RouterSolicitation{
+		Header: ICMPv6MessageHeader{
+			Type:     b[0],
+			Code:     b[1],
+			Checksum: binary.BigEndian.Uint16(b[2:4]),
+		},
+		Reserved: binary.BigEndian.Uint32(b[4:8]),
+	}
+	// this also rejects options with length zero
+	var err error
+	m.Options, err = ICMPv6ParseOptions(b[8:])
+	if err != nil {
+		return nil, err
+	}
+	if ipHeader.Src.IsUnspecified() && m.SourceLinkAddress() != nil {
+		return nil, errors.New("unspecified source and source link-layer address option")
+	}
+	return m, nil
+}
+
+// Validate a received router advertisement as described in RFC 4861 section 6.1.2
+func ICMPv6ValidateRouterAdvertisement(ipHeader *IPv6Header, b []byte) (*ICMPv6RouterAdvertisement, error) {
+	if !ipHeader.Src.IsLinkLocalUnicast() {
+		return nil, fmt.Errorf("source %s is not link-local", ipHeader.Src)
+	}
+	if ipHeader.HopLimit != 255 {
+		return nil, fmt.Errorf("hop limit is %d, not 255", ipHeader.HopLimit)
+	}
+	if len(b) < 16 {
+		return nil, fmt.Errorf("ICMP length is %d, less than 16 octets", len(b))
+	}
+	if !ICMPv6VerifyChecksum(ipHeader, b) {
+		return nil, errors.New("invalid checksum")
+	}
+	if b[1] != 0 {
+		return nil, fmt.Errorf("ICMP code is %d, not 0", b[1])
+	}
+	// this also rejects options with length zero
+	return ICMPv6ParseRouterAdvertisement(b)
+}
+
+// Parse a router advertisement, the options may appear in any order
+func ICMPv6ParseRouterAdvertisement(b []byte) (m *ICMPv6RouterAdvertisement, err error) {
+	// Fixed part: header, hop limit, flags, lifetime, timers
+	if len(b) < 16 {
+		return nil, errors.New("Message is to short")
+	}
+	m = &ICMPv6RouterAdvertisement{
+		Header: ICMPv6MessageHeader{
+			Type:     b[0],
+			Code:     b[1],
+			Checksum: binary.BigEndian.Uint16(b[2:4]),
+		},
+		CurHopLimit:    b[4],
+		Flags:          b[5],
+		RouterLifetime: binary.BigEndian.Uint16(b[6:8]),
+		ReachableTime:  binary.BigEndian.Uint32(b[8:12]),
+		RetransTimer:   binary.BigEndian.Uint32(b[12:16]),
+	}
+	if m.Header.Type != 0x86 {
+		return nil, errors.New("Message is no router advertisement")
+	}
+	m.Options, err = ICMPv6ParseOptions(b[16:])
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Validate a received neighbor solicitation as described in RFC 4861 section 7.1.1
+func ICMPv6ValidateNeighborSolicitation(ipHeader *IPv6Header, b []byte) (*ICMPv6NeighborSolicitation, error) {
+	if ipHeader.HopLimit != 255 {
+		return nil, fmt.Errorf("hop limit is %d, not 255", ipHeader.HopLimit)
+	}
+	if len(b) < 24 {
+		return nil, fmt.Errorf("ICMP length is %d, less than 24 octets", len(b))
+	}
+	if !ICMPv6VerifyChecksum(ipHeader, b) {
+		return nil, errors.New("invalid checksum")
+	}
+	if b[1] != 0 {
+		return nil, fmt.Errorf("ICMP code is %d, not 0", b[1])
+	}
+	// this also rejects options with length zero
+	m, err := ICMPv6ParseNeighborSolicitation(b)
+	if err != nil {
+		return nil, err
+	}
+	if net.IP(m.TargetAddress[:]).IsMulticast() {
+		return nil, errors.New("target address is multicast")
+	}
+	// duplicate address detection is sent from :: to the solicited-node group
+	if ipHeader.Src.IsUnspecified() {
+		if !ipHeader.Dst.Equal(SolicitedNodeAddress(ipHeader.Dst)) {
+			return nil, errors.New("unspecified source and no solicited-node destination")
+		}
+		if m.SourceLinkAddress() != nil {
+			return nil, errors.New("unspecified source and source link-layer address option")
+		}
+	}
+	return m, nil
+}
+
+// Parse a neighbor solicitation, the options may appear in any order
+func ICMPv6ParseNeighborSolicitation(b []byte) (m *ICMPv6NeighborSolicitation, err error) {
+	// Fixed part: header, reserved, target address
+	if len(b) < 24 {
+		return nil, errors.New("Message is to short")
+	}
+	m = &ICMPv6NeighborSolicitation{
+		Header: ICMPv6MessageHeader{
+			Type:     b[0],
+			Code:     b[1],
+			Checksum: binary.BigEndian.Uint16(b[2:4]),
+		},
+		Reserved: binary.BigEndian.Uint32(b[4:8]),
+	}
+	copy(m.TargetAddress[:], b[8:24])
+	if m.Header.Type != 0x87 {
+		return nil, errors.New("Message is no neighbor solicitation")
+	}
+	m.Options, err = ICMPv6ParseOptions(b[24:])
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Parse a neighbor advertisement, the options may appear in any order
+func ICMPv6ParseNeighborAdvertisement(b []byte) (m *ICMPv6NeighborAdvertisement, err error) {
+	// Fixed part: header, flags, target address
+	if len(b) < 24 {
+		return nil, errors.New("Message is to short")
+	}
+	m = &ICMPv6NeighborAdvertisement{
+		Header: ICMPv6MessageHeader{
+			Type:     b[0],
+			Code:     b[1],
+			Checksum: binary.BigEndian.Uint16(b[2:4]),
+		},
+		Flags: binary.BigEndian.Uint32(b[4:8]),
+	}
+	copy(m.TargetAddress[:], b[8:24])
+	if m.Header.Type != 0x88 {
 		return nil, errors.New("Message is no neighbor advertisement")
 	}
+	m.Options, err = ICMPv6ParseOptions(b[24:])
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Validate a received echo reply
+func ICMPv6ValidateEchoReply(ipHeader *IPv6Header, b []byte) (*ICMPv6Echo, error) {
+	if !ICMPv6VerifyChecksum(ipHeader, b) {
+		return nil, errors.New("invalid checksum")
+	}
+	m, err := ICMPv6ParseEcho(b)
+	if err != nil {
+		return nil, err
+	}
+	if m.Header.Type != 0x81 {
+		return nil, errors.New("Message is no echo reply")
+	}
+	if m.Header.Code != 0 {
+		return nil, fmt.Errorf("ICMP code is %d, not 0", m.Header.Code)
+	}
+	return m, nil
+}
 
+// Parse an echo request or reply
+func ICMPv6ParseEcho(b []byte) (*ICMPv6Echo, error) {
+	if len(b) < 8 {
+		return nil, errors.New("Message is to short")
+	}
+	m := &ICMPv6Echo{
+		Header: ICMPv6MessageHeader{
+			Type:     b[0],
+			Code:     b[1],
+			Checksum: binary.BigEndian.Uint16(b[2:4]),
+		},
+		Identifier: binary.BigEndian.Uint16(b[4:6]),
+		Sequence:   binary.BigEndian.Uint16(b[6:8]),
+		Data:       append([]byte(nil), b[8:]...),
+	}
+	if m.Header.Type != 0x80 && m.Header.Type != 0x81 {
+		return nil, errors.New("Message is no echo request or reply")
+	}
 	return m, nil
 }
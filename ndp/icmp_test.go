@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestParseNeighborAdvertisementFlags(t *testing.T) {
+	b := make([]byte, 24)
+	b[0] = 0x88
+	tests := map[byte][3]bool{
+		0x00: {false, false, false},
+		0x80: {true, false, false},
+		0x40: {false, true, false},
+		0x20: {false, false, true},
+		0xe0: {true, true, true},
+	}
+	for flags, expected := range tests {
+		b[4] = flags
+		m, err := ICMPv6ParseNeighborAdvertisement(b)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if m.FlagSet(ICMPv6NeighborAdvertisementFlagR) != expected[0] ||
+			m.FlagSet(ICMPv6NeighborAdvertisementFlagS) != expected[1] ||
+			m.FlagSet(ICMPv6NeighborAdvertisementFlagO) != expected[2] {
+			t.Errorf("Flags %02x are reported wrong", flags)
+		}
+	}
+}
+
+func TestNeighborSolicitation(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	target := net.ParseIP("fd01::2")
+	m := ICMPv6NeighborSolicitation{
+		Header: ICMPv6MessageHeader{Type: 0x87},
+	}
+	copy(m.TargetAddress[:], target)
+	ipHeader := IPv6Header{
+		PayloadLen: 24,
+		NextHeader: 0x3a,
+		HopLimit:   255,
+		Src:        net.IPv6unspecified,
+		Dst:        SolicitedNodeAddress(target),
+	}
+	if ipHeader.Dst.String() != "ff02::1:ff00:2" {
+		t.Errorf("Solicited-node address is %s", ipHeader.Dst)
+	}
+	// duplicate address detection, without source link-layer address
+	b := m.Marshal()
+	if len(b) != 24 {
+		t.Fatalf("Marshaled solicitation has length %d", len(b))
+	}
+	binary.BigEndian.PutUint16(b[2:4], ICMPv6Checksum(ipHeader, b))
+	if _, err := ICMPv6ValidateNeighborSolicitation(&ipHeader, b); err != nil {
+		t.Error(err.Error())
+	}
+	// the unspecified source must not come with a source link-layer address
+	m.Options = []ICMPv6Option{&ICMPv6LinkAddressOption{OptionType: ICMPv6OptionSourceLinkAddress, Addr: mac}}
+	b = m.Marshal()
+	if len(b) != 32 {
+		t.Fatalf("Marshaled solicitation has length %d", len(b))
+	}
+	ipHeader.PayloadLen = 32
+	binary.BigEndian.PutUint16(b[2:4], ICMPv6Checksum(ipHeader, b))
+	if _, err := ICMPv6ValidateNeighborSolicitation(&ipHeader, b); err == nil {
+		t.Error("Source link-layer address from :: was accepted")
+	}
+	ipHeader.Src = net.ParseIP("fd01::1")
+	binary.BigEndian.PutUint16(b[2:4], 0)
+	binary.BigEndian.PutUint16(b[2:4], ICMPv6Checksum(ipHeader, b))
+	n, err := ICMPv6ValidateNeighborSolicitation(&ipHeader, b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.SourceLinkAddress().String() != mac.String() {
+		t.Error("Source link-layer address differs")
+	}
+}
+
+func TestNeighborAdvertisementMarshal(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	m := ICMPv6NeighborAdvertisement{
+		Header:  ICMPv6MessageHeader{Type: 0x88},
+		Options: []ICMPv6Option{&ICMPv6LinkAddressOption{OptionType: ICMPv6OptionTargetLinkAddress, Addr: mac}},
+	}
+	m.SetFlags(ICMPv6NeighborAdvertisementFlagS | ICMPv6NeighborAdvertisementFlagO)
+	copy(m.TargetAddress[:], net.ParseIP("fd01::2"))
+	n, err := ICMPv6ParseNeighborAdvertisement(m.Marshal())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.FlagSet(ICMPv6NeighborAdvertisementFlagR) || !n.FlagSet(ICMPv6NeighborAdvertisementFlagS) || !n.FlagSet(ICMPv6NeighborAdvertisementFlagO) {
+		t.Error("Flags differ")
+	}
+	if n.TargetAddress != m.TargetAddress || n.TargetLinkAddress().String() != mac.String() {
+		t.Error("Unmarshaled advertisement differs")
+	}
+}
+
+func TestEchoReply(t *testing.T) {
+	m := ICMPv6Echo{
+		Header:     ICMPv6MessageHeader{Type: 0x81},
+		Identifier: 0x1234,
+		Sequence:   7,
+		Data:       []byte("ping"),
+	}
+	ipHeader := IPv6Header{
+		NextHeader: 0x3a,
+		Src:        net.ParseIP("fe80::2"),
+		Dst:        net.ParseIP("fe80::1"),
+	}
+	b := m.Marshal()
+	binary.BigEndian.PutUint16(b[2:4], ICMPv6Checksum(ipHeader, b))
+	n, err := ICMPv6ValidateEchoReply(&ipHeader, b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if n.Identifier != m.Identifier || n.Sequence != m.Sequence || string(n.Data) != "ping" {
+		t.Error("Unmarshaled echo reply differs")
+	}
+	b[0] = 0x80
+	binary.BigEndian.PutUint16(b[2:4], 0)
+	binary.BigEndian.PutUint16(b[2:4], ICMPv6Checksum(ipHeader, b))
+	if _, err := ICMPv6ValidateEchoReply(&ipHeader, b); err == nil {
+		t.Error("Echo request was accepted as reply")
+	}
+}
+
+func TestValidateNeighborAdvertisement(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	m := ICMPv6NeighborAdvertisement{
+		Header:  ICMPv6MessageHeader{Type: 0x88},
+		Options: []ICMPv6Option{&ICMPv6LinkAddressOption{OptionType: ICMPv6OptionTargetLinkAddress, Addr: mac}},
+	}
+	m.SetFlags(ICMPv6NeighborAdvertisementFlagS)
+	copy(m.TargetAddress[:], net.ParseIP("fd01::2"))
+	valid := m.Marshal()
+	header := func() IPv6Header {
+		return IPv6Header{
+			PayloadLen: len(valid),
+			NextHeader: 0x3a,
+			HopLimit:   255,
+			Src:        net.ParseIP("fd01::2"),
+			Dst:        net.ParseIP("fd01::1"),
+		}
+	}
+	tests := []struct {
+		name   string
+		header func(h *IPv6Header)
+		// changes the message before the checksum is calculated
+		message func(b []byte) []byte
+		// breaks the checksum
+		corrupt bool
+		valid   bool
+	}{
+		{name: "valid", valid: true},
+		{name: "hop limit", header: func(h *IPv6Header) { h.HopLimit = 64 }},
+		{name: "code", message: func(b []byte) []byte { b[1] = 1; return b }},
+		{name: "checksum", corrupt: true},
+		{name: "multicast target", message: func(b []byte) []byte { b[8] = 0xff; return b }},
+		{name: "solicited to multicast", header: func(h *IPv6Header) { h.Dst = net.ParseIP("ff02::1") }},
+		{name: "unsolicited to multicast", header: func(h *IPv6Header) { h.Dst = net.ParseIP("ff02::1") },
+			message: func(b []byte) []byte { b[4] = 0; return b }, valid: true},
+		{name: "short", message: func(b []byte) []byte { return b[:20] }},
+		{name: "zero length option", message: func(b []byte) []byte { b[25] = 0; return b }},
+	}
+	for _, test := range tests {
+		h := header()
+		if test.header != nil {
+			test.header(&h)
+		}
+		b := append([]byte(nil), valid...)
+		if test.message != nil {
+			b = test.message(b)
+		}
+		h.PayloadLen = len(b)
+		binary.BigEndian.PutUint16(b[2:4], ICMPv6Checksum(h, b))
+		if test.corrupt {
+			b[2] ^= 0xff
+		}
+		_, err := ICMPv6ValidateNeighborAdvertisement(&h, b)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error %v, expected valid %t", test.name, err, test.valid)
+		}
+	}
+}
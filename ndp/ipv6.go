@@ -102,3 +102,15 @@ func (h *IPv6PseudoHeader) Marshal() []byte {
 	}
 	return buffer.Bytes()
 }
+
+// Create solicited-node multicast address prefix ff02::1:ff00:0/104
+func SolicitedNodeAddress(ip net.IP) net.IP {
+	ip = ip.To16()
+	return net.ParseIP(fmt.Sprintf("ff02::1:ff%02x:%02x%02x", ip[13], ip[14], ip[15]))
+}
+
+// Multicast mac address of an IPv6 multicast address, RFC 2464 section 7
+func MulticastMac(ip net.IP) net.HardwareAddr {
+	ip = ip.To16()
+	return net.HardwareAddr{0x33, 0x33, ip[12], ip[13], ip[14], ip[15]}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unsafe"
+)
+
+// rtnetlink neighbor messages, see linux/neighbour.h and man 7 rtnetlink
+const (
+	ndmsgLen     = 12
+	rtattrLen    = 4
+	ndaDst       = 1
+	ndaLladdr    = 2
+	ntfRouter    = 0x80
+	nudReachable = 0x02
+	nudStale     = 0x04
+	nudDelay     = 0x08
+	nudProbe     = 0x10
+	nudNoarp     = 0x40
+	nudPermanent = 0x80
+)
+
+// Netlink messages are in host byte order
+var nativeEndian binary.ByteOrder = binary.LittleEndian
+
+func init() {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 0 {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// An entry of the kernel neighbor table
+type kernelNeighbor struct {
+	Family   uint8
+	Ifindex  int
+	IP       net.IP
+	Mac      net.HardwareAddr // nil while incomplete or failed
+	State    uint16
+	IsRouter bool
+}
+
+func (n *kernelNeighbor) String() string {
+	s := n.IP.String()
+	if n.Mac != nil {
+		s += " lladdr " + n.Mac.String()
+	}
+	if n.IsRouter {
+		s += " router"
+	}
+	return s + " " + neighborState(n.State)
+}
+
+// Whether the kernel trusts the MAC address of the entry
+func (n *kernelNeighbor) Valid() bool {
+	return n.Mac != nil && n.State&(nudReachable|nudStale|nudDelay|nudProbe|nudPermanent|nudNoarp) != 0
+}
+
+// Names of the states like ip neigh shows them
+func neighborState(state uint16) string {
+	names := []string{"INCOMPLETE", "REACHABLE", "STALE", "DELAY", "PROBE", "FAILED", "NOARP", "PERMANENT"}
+	var set []string
+	for i, name := range names {
+		if state&(1<<uint(i)) != 0 {
+			set = append(set, name)
+		}
+	}
+	if len(set) == 0 {
+		return "NONE"
+	}
+	return strings.Join(set, ",")
+}
+
+// Parse the payload of an RTM_NEWNEIGH message: struct ndmsg followed by attributes
+func parseNeighborMessage(b []byte) (*kernelNeighbor, error) {
+	if len(b) < ndmsgLen {
+		return nil, errors.New("neighbor message is too short")
+	}
+	n := &kernelNeighbor{
+		Family:   b[0],
+		Ifindex:  int(int32(nativeEndian.Uint32(b[4:8]))),
+		State:    nativeEndian.Uint16(b[8:10]),
+		IsRouter: b[10]&ntfRouter != 0,
+	}
+	for b = b[ndmsgLen:]; len(b) >= rtattrLen; {
+		l := int(nativeEndian.Uint16(b[0:2]))
+		if l < rtattrLen || l > len(b) {
+			return nil, fmt.Errorf("invalid attribute length %d", l)
+		}
+		value := b[rtattrLen:l]
+		switch nativeEndian.Uint16(b[2:4]) {
+		case ndaDst:
+			n.IP = net.IP(append([]byte(nil), value...))
+		case ndaLladdr:
+			n.Mac = net.HardwareAddr(append([]byte(nil), value...))
+		}
+		// attributes are aligned to 4 bytes
+		l = (l + 3) &^ 3
+		if l > len(b) {
+			l = len(b)
+		}
+		b = b[l:]
+	}
+	if n.IP == nil {
+		return nil, errors.New("neighbor message has no destination")
+	}
+	return n, nil
+}
+
+// Build the payload of an RTM_NEWNEIGH request that sets ip to mac on the interface ifindex
+func neighborRequest(family uint8, ifindex int, ip net.IP, mac net.HardwareAddr, state uint16, router bool) []byte {
+	var buffer bytes.Buffer
+	var flags uint8
+	if router {
+		flags = ntfRouter
+	}
+	// struct ndmsg: family, padding, interface, state, flags, type
+	buffer.Write([]byte{family, 0, 0, 0})
+	binary.Write(&buffer, nativeEndian, int32(ifindex))
+	binary.Write(&buffer, nativeEndian, state)
+	buffer.Write([]byte{flags, 0})
+	if ip.To4() != nil {
+		ip = ip.To4()
+	}
+	for _, attr := range []struct {
+		t     uint16
+		value []byte
+	}{{ndaDst, ip}, {ndaLladdr, mac}} {
+		binary.Write(&buffer, nativeEndian, []uint16{uint16(rtattrLen + len(attr.value)), attr.t})
+		buffer.Write(attr.value)
+		buffer.Write(make([]byte, (4-len(attr.value)%4)%4))
+	}
+	return buffer.Bytes()
+}
+
+// Compare the kernel entry of target, nil if there is none, with the MAC addresses that answered on the wire and
+// describe the mismatch, empty if they agree
+func kernelMismatch(target net.IP, entry *kernelNeighbor, answered []net.HardwareAddr) string {
+	switch {
+	case len(answered) == 0 && entry != nil && entry.Valid():
+		return fmt.Sprintf("the kernel has %s at %s (%s), but it did not answer", target, entry.Mac, neighborState(entry.State))
+	case len(answered) == 0 || entry == nil:
+		// the kernel only knows the neighbors it talked to
+		return ""
+	case !entry.Valid():
+		return fmt.Sprintf("the kernel has %s as %s, but %s answered", target, neighborState(entry.State), answered[0])
+	}
+	for _, mac := range answered {
+		if !bytes.Equal(mac, entry.Mac) {
+			return fmt.Sprintf("the kernel has %s at %s (%s), but %s answered", target, entry.Mac, neighborState(entry.State), mac)
+		}
+	}
+	return ""
+}
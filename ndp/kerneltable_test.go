@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNeighborMessage(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	for _, ip := range []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("fd01::2")} {
+		b := neighborRequest(2, 7, ip, mac, nudReachable, true)
+		if len(b)%4 != 0 {
+			t.Errorf("Request for %s is not aligned", ip)
+		}
+		n, err := parseNeighborMessage(b)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if n.Family != 2 || n.Ifindex != 7 || !n.IP.Equal(ip) || n.Mac.String() != mac.String() || !n.IsRouter || !n.Valid() {
+			t.Errorf("Parsed neighbor %s differs", n)
+		}
+	}
+	if _, err := parseNeighborMessage(make([]byte, ndmsgLen)); err == nil {
+		t.Error("Neighbor without destination was accepted")
+	}
+	if s := neighborState(nudStale | nudPermanent); s != "STALE,PERMANENT" {
+		t.Errorf("State is %s", s)
+	}
+}
+
+func TestKernelMismatch(t *testing.T) {
+	target := net.ParseIP("fd01::2")
+	a, _ := net.ParseMAC("02:00:00:00:00:0a")
+	b, _ := net.ParseMAC("02:00:00:00:00:0b")
+	reachable := &kernelNeighbor{IP: target, Mac: a, State: nudReachable}
+	failed := &kernelNeighbor{IP: target, State: 0x20}
+	tests := []struct {
+		entry    *kernelNeighbor
+		answered []net.HardwareAddr
+		mismatch bool
+	}{
+		{nil, nil, false},
+		{nil, []net.HardwareAddr{a}, false},
+		{reachable, []net.HardwareAddr{a}, false},
+		{reachable, []net.HardwareAddr{b}, true},
+		{reachable, []net.HardwareAddr{a, b}, true},
+		{reachable, nil, true},
+		{failed, nil, false},
+		{failed, []net.HardwareAddr{a}, true},
+	}
+	for i, test := range tests {
+		if s := kernelMismatch(target, test.entry, test.answered); (s != "") != test.mismatch {
+			t.Errorf("Test %d reports %q", i, s)
+		}
+	}
+}
@@ -7,63 +7,349 @@ import (
 	"encoding/binary"
 	"flag"
 	"fmt"
+	"grnvs/pcap"
 	"net"
 	"os"
+	"os/signal"
 	"path"
-	"strings"
 	"syscall"
 	"time"
 )
 
+// Exit codes that tell scripts the result of the lookup
+const (
+	exitResolved = 0
+	exitNoAnswer = 1
+	exitConflict = 2 // several MAC addresses claim the target
+	exitMismatch = 4 // -kernel: the kernel neighbor table disagrees with the answers
+	exitKernel   = 5 // -kernel: the kernel neighbor table could not be read or -install failed
+	// -dad
+	exitFree  = 0
+	exitInUse = 3
+)
+
 func main() {
 	// Define console flags
 	interfaceName := flag.String("i", "eth0", "Network interface; Default is eth0")
 	timeout := flag.Int("t", 5, "Timout in seconds; default is 5")
+	tries := flag.Int("n", 3, "Number of neighbor solicitations (MAX_MULTICAST_SOLICIT); default is 3")
+	retransTimer := flag.Int("r", 1000, "Time between neighbor solicitations in milliseconds (RetransTimer); default is 1000")
+	collectTime := flag.Int("c", 500, "Time in milliseconds to wait for further answers after the first one; default is 500")
+	captureFile := flag.String("w", "", "Write sent and received frames to this pcapng file")
+	dryRun := flag.Bool("dry-run", false, "Only write the neighbor solicitation to the -w file, no socket is opened")
+	verbose := flag.Bool("v", false, "Report why received neighbor advertisements were dropped")
+	dad := flag.Bool("dad", false, "Duplicate address detection: check whether the target address is in use")
+	nud := flag.String("nud", "", "Neighbor unreachability detection: probe the target at this known MAC address with unicast solicitations every -r milliseconds")
+	count := flag.Int("count", 0, "Number of -nud probes, 0 probes until interrupted; default is 0")
+	ramonFile := flag.String("ramon", "", "Monitor router advertisements against the legitimate routers in this file until killed")
+	alertFile := flag.String("alerts", "", "Append -ramon alerts as JSON lines to this file")
+	ndpmonFile := flag.String("ndpmon", "", "Record every IPv6-to-MAC binding in this state file and report spoofing until killed, puts the interface into promiscuous mode")
+	cacheFlag := flag.Bool("cache", false, "Resolve the addresses read from stdin, one per line, through an RFC 4861 neighbor cache")
+	proxyFile := flag.String("proxy", "", "Answer neighbor solicitations for the addresses and prefixes in this file until killed")
+	rdiscMode := flag.Bool("rdisc", false, "Router discovery: send router solicitations to ff02::2 and print all router advertisements within the timeout")
+	kernelFlag := flag.Bool("kernel", false, "Show the kernel neighbor table entry of the target next to the answers and report mismatches")
+	install := flag.String("install", "", "Write the answered MAC address to the kernel neighbor table as reachable or permanent entry, implies -kernel")
+	echoMode := flag.Bool("echo", false, "Send echo requests to ff02::1 and print the addresses that answered within the timeout per MAC address")
+	echoRouters := flag.Bool("echo-routers", false, "Send the -echo requests to ff02::2 as well")
+	sweepMode := flag.Bool("sweep", false, "Resolve many addresses concurrently: the arguments and the addresses of -from, -low, -eui64 and -seen")
+	fromFile := flag.String("from", "", "Sweep the addresses in this file, one per line")
+	lowPrefix := flag.String("low", "", "Sweep the addresses ::1 to ::ff of this prefix")
+	eui64Prefix := flag.String("eui64", "", "Sweep the EUI-64 addresses of the -macs in this /64 prefix")
+	macsFile := flag.String("macs", "", "Known MAC addresses for -eui64, one per line")
+	seenFile := flag.String("seen", "", "Sweep the on-link addresses seen in this pcap or pcapng capture")
+	rate := flag.Int("rate", 100, fmt.Sprintf("Maximum number of -sweep solicitations per second, at most %d; default is 100", maxRate))
 	// Define error message / help
 	flag.Usage = func() {
-		fmt.Printf("Usage: %s -i <network-interface> -t <timeout in sec> <target ipv6 address>\n", path.Base(os.Args[0]))
+		fmt.Printf("Usage: %s -i <network-interface> -t <timeout in sec> [-n <tries>] [-r <retrans timer in ms>] [-c <collect time in ms>] [-dad | -nud <mac> [-count <probes>] | -kernel [-install reachable|permanent]] [-v] [-w <file.pcap> [-dry-run]] <target ipv6 or ipv4 address>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -sweep -i <network-interface> [-from <file>] [-low <prefix>] [-eui64 <prefix> -macs <file>] [-seen <file.pcap>] [-rate <per sec>] [-n <tries>] [-r <retrans timer in ms>] [-v] [-w <file.pcap> [-dry-run]] [<target ipv6 address>...]\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -echo -i <network-interface> -t <timeout in sec> [-echo-routers] [-n <tries>] [-r <retrans timer in ms>] [-v] [-w <file.pcap> [-dry-run]]\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -rdisc -i <network-interface> -t <timeout in sec> [-n <tries>] [-r <retrans timer in ms>] [-v] [-w <file.pcap> [-dry-run]]\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -cache -i <network-interface> [-v] [-w <file.pcap>] < addresses\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -proxy <addresses file> -i <network-interface> [-v] [-w <file.pcap>]\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -ndpmon <state file> -i <network-interface> [-v] [-w <file.pcap>]\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -ramon <routers file> -i <network-interface> [-alerts <file.json>] [-v] [-w <file.pcap>]\n", path.Base(os.Args[0]))
 	}
 	// Parse command line flags
 	flag.Parse()
-	// Validate arguments count
-	if flag.NArg() != 1 {
+	// Validate arguments count, router discovery has no target
+	args := 1
+	if *rdiscMode || *ramonFile != "" || *ndpmonFile != "" || *cacheFlag || *proxyFile != "" || *echoMode {
+		args = 0
+	}
+	// a sweep takes any number of targets
+	if *sweepMode {
+		args = flag.NArg()
+	}
+	// the kernel table is compared after address resolution only
+	kernelCompare := *kernelFlag || *install != ""
+	if kernelCompare && (args != 1 || *sweepMode || *dad || *nud != "") || *install != "" && *install != "reachable" && *install != "permanent" {
 		flag.Usage()
 		return
 	}
-	// Validate and parse the destination IPv6 address
+	if flag.NArg() != args || *tries < 1 || *retransTimer < 1 || *collectTime < 0 || *count < 0 || *rate < 1 || *rate > maxRate || *dad && *nud != "" || *sweepMode && (*dad || *nud != "") || (*eui64Prefix == "") != (*macsFile == "") || *dryRun && *captureFile == "" {
+		flag.Usage()
+		return
+	}
+	// Validate and parse the destination address, IPv4 addresses are resolved with ARP
 	lookupAddr := net.ParseIP(flag.Arg(0))
-	if lookupAddr == nil || lookupAddr.To4() != nil {
+	if args == 1 && !*sweepMode && lookupAddr == nil {
 		return // as requested in the assignment
 	}
+	ipv4 := !*sweepMode && lookupAddr.To4() != nil
 	// Find the network interface by its name
 	networkInterface, err := net.InterfaceByName(*interfaceName)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "The selected network interface %s does not exist.\n", *interfaceName)
 		return
 	}
+	// Known MAC address of the target for unicast probes
+	var nudMac net.HardwareAddr
+	if *nud != "" {
+		nudMac, err = net.ParseMAC(*nud)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s is no valid MAC address.\n", *nud)
+			return
+		}
+	}
+	// Record frames
+	if *captureFile != "" {
+		f, err := openCapture(*captureFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to create %s.\n", *captureFile)
+			return
+		}
+		defer f.Close()
+	}
+	if *proxyFile != "" {
+		entries, err := readProxies(*proxyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read proxied addresses.\n%s\n", err.Error())
+			return
+		}
+		os.Exit(proxy(networkInterface, entries, *verbose))
+	}
+	if *ndpmonFile != "" {
+		os.Exit(ndpmon(networkInterface, *ndpmonFile, *verbose))
+	}
+	if *ramonFile != "" {
+		routers, err := readRouters(*ramonFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read legitimate routers.\n%s\n", err.Error())
+			return
+		}
+		os.Exit(ramon(networkInterface, routers, *alertFile, *verbose))
+	}
+	if *echoMode {
+		os.Exit(echoDiscovery(networkInterface, *echoRouters, time.Duration(*timeout)*time.Second, *tries, time.Duration(*retransTimer)*time.Millisecond, *dryRun, *verbose))
+	}
+	if *rdiscMode {
+		os.Exit(rdisc(networkInterface, time.Duration(*timeout)*time.Second, *tries, time.Duration(*retransTimer)*time.Millisecond, *dryRun, *verbose))
+	}
+
+	// Get source address, duplicate address detection is sent from :: and ARP probes from 0.0.0.0
+	sAddr := net.IPv6unspecified
+	if ipv4 {
+		sAddr = net.IPv4zero
+		if !*dad {
+			sAddr = getSrcAddr4(networkInterface)
+			if sAddr == nil {
+				fmt.Fprintf(os.Stderr, "The network interface %s has no IPv4 address.\n", networkInterface.Name)
+				return
+			}
+		}
+	} else if !*dad {
+		sAddr = getSrcAddr(networkInterface)
+		if sAddr == nil {
+			return
+		}
+	}
+
+	if *cacheFlag {
+		os.Exit(cacheMode(networkInterface, sAddr, *verbose))
+	}
+	if *sweepMode {
+		targets, err := sweepTargets(networkInterface, flag.Args(), *fromFile, *lowPrefix, *eui64Prefix, *macsFile, *seenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to collect the sweep targets.\n%s\n", err.Error())
+			return
+		}
+		os.Exit(sweep(networkInterface, sAddr, targets, *rate, *tries, time.Duration(*retransTimer)*time.Millisecond, *dryRun, *verbose))
+	}
+
+	var data []byte
+	var dMac net.HardwareAddr
+	if ipv4 {
+		// ARP requests are broadcast, unreachability detection is sent directly to the neighbor
+		dMac = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+		if nudMac != nil {
+			dMac = nudMac
+		}
+		data = buildARPRequest(networkInterface, sAddr, dMac, lookupAddr)
+	} else {
+		// Create solicited-node multicast address
+		dAddr := SolicitedNodeAddress(lookupAddr)
+
+		// Build destination mac
+		dMac = MulticastMac(dAddr)
+		// Unreachability detection is sent directly to the neighbor, RFC 4861 section 7.3.3
+		if nudMac != nil {
+			dAddr = lookupAddr
+			dMac = nudMac
+		}
+		data = buildSolicitation(networkInterface, sAddr, dAddr, dMac, lookupAddr)
+	}
+	// Only record the frame
+	if *dryRun {
+		record(networkInterface.Name, data, pcap.Outbound)
+		return
+	}
 	// Create raw socket, sudo required see man 7 raw
 	socket, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(syscall.ETH_P_ALL)))
 	if err != nil {
 		panic(err)
 	}
 	defer syscall.Close(socket)
+	// Make socket address
+	sockAddr := syscall.SockaddrLinklayer{
+		Protocol: htons(syscall.ETH_P_ALL),
+		Ifindex:  networkInterface.Index,
+	}
+	// Competing duplicate address detection is sent to the solicited-node group
+	if *dad && !ipv4 {
+		err = addMembership(socket, networkInterface, syscall.PACKET_MR_MULTICAST, dMac)
+		if err != nil {
+			panic(err)
+		}
+	}
+	// Send data
+	send := func() {
+		err := syscall.Sendto(socket, data, 0, &sockAddr)
+		if err != nil {
+			panic(err)
+		}
+		record(networkInterface.Name, data, pcap.Outbound)
+	}
 
-	// Get source address
-	sAddr := getSrcAddr(networkInterface)
-	if sAddr == nil {
-		return
+	// Report invalid or unrelated messages in verbose mode
+	dropped := func(src net.IP, reason string) {
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Dropped neighbor advertisement from %s: %s\n", src, reason)
+		}
+	}
+	droppedSolicitation := func(src net.IP, reason string) {
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Dropped neighbor solicitation from %s: %s\n", src, reason)
+		}
 	}
 
-	// Create solicited-node multicast address prefix ff02::1:ff00:0/104
-	dAddr := net.ParseIP(fmt.Sprintf("ff02::1:ff%02x:%02x%02x", lookupAddr[13], lookupAddr[14], lookupAddr[15]))
-	if dAddr == nil {
-		return
+	// Data channel
+	dataIn := make(chan *answer, 1)
+
+	// Create socket, taken from http://www.darkcoding.net/software/raw-sockets-in-go-link-layer/
+	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
+	defer f.Close()
+
+	// package parsing
+	receive := func() {
+		// Adapted from http://www.darkcoding.net/software/raw-sockets-in-go-link-layer/
+		for {
+			b := make([]byte, 1024)
+			numRead, err := f.Read(b)
+			if err != nil {
+				panic(err)
+			}
+			received := time.Now()
+			eFrame, err := EthernetFrameParse(b[:EthernetFrameLen])
+			// only ipv6 and only for the choosen interface, the answers to duplicate address detection are multicast
+			own := bytes.Equal(eFrame.SrcMac[:], networkInterface.HardwareAddr)
+			multicast := eFrame.DstMac[0] == 0x33 && eFrame.DstMac[1] == 0x33
+			if eFrame.Ethertype == 0x86DD && (bytes.Equal(eFrame.DstMac[:], networkInterface.HardwareAddr) || *dad && multicast && !own) {
+				record(networkInterface.Name, b[:numRead], pcap.Inbound)
+				// Parse ipv6 package
+				offset := binary.Size(eFrame)
+				header, err := IPv6ParseHeader(b[offset:numRead])
+				if err != nil || header.NextHeader != 0x3a {
+					continue
+				}
+				// increase offset
+				offset += IPv6HeaderLen
+				// only neighbor advertisements are of interest, and competing solicitations in -dad mode
+				if offset >= numRead || b[offset] != 0x88 && !(*dad && b[offset] == 0x87) {
+					continue
+				}
+				// the icmp message ends with the ip payload, ethernet padding is ignored
+				if offset+header.PayloadLen > numRead {
+					dropped(header.Src, "message is truncated")
+					continue
+				}
+				etherSrc := net.HardwareAddr(append([]byte(nil), eFrame.SrcMac[:]...))
+				if b[offset] == 0x87 {
+					ns, err := ICMPv6ValidateNeighborSolicitation(header, b[offset:offset+header.PayloadLen])
+					if err != nil {
+						droppedSolicitation(header.Src, err.Error())
+						continue
+					}
+					// address resolution by others is no conflict
+					if target := net.IP(ns.TargetAddress[:]); !target.Equal(lookupAddr) || !header.Src.IsUnspecified() {
+						continue
+					}
+					dataIn <- &answer{
+						NS:       ns,
+						EtherSrc: etherSrc,
+						Time:     received,
+					}
+					continue
+				}
+				na, err := ICMPv6ValidateNeighborAdvertisement(header, b[offset:offset+header.PayloadLen])
+				if err != nil {
+					dropped(header.Src, err.Error())
+					continue
+				}
+				// an unrelated advertisement is no answer to our query
+				if target := net.IP(na.TargetAddress[:]); !target.Equal(lookupAddr) {
+					dropped(header.Src, fmt.Sprintf("target %s is not %s", target, lookupAddr))
+					continue
+				}
+				// Solicited answers may omit the target link-layer address, the ethernet source is used then
+				if na.TargetLinkAddress() == nil && !na.FlagSet(ICMPv6NeighborAdvertisementFlagS) {
+					dropped(header.Src, "unsolicited and no target link-layer address option")
+					continue
+				}
+				// Put message into channel
+				dataIn <- &answer{
+					NA:       na,
+					EtherSrc: etherSrc,
+					Time:     received,
+				}
+			}
+		}
+	}
+	if ipv4 {
+		receive = func() {
+			receiveARP(f, networkInterface, lookupAddr, *dad, *verbose, dataIn)
+		}
+	}
+	go receive()
+
+	if nudMac != nil {
+		os.Exit(probe(lookupAddr, nudMac, send, dataIn, time.Duration(*retransTimer)*time.Millisecond, *count))
+	}
+
+	answers := collectAnswers(send, dataIn, *tries, time.Duration(*retransTimer)*time.Millisecond, time.Duration(*collectTime)*time.Millisecond, time.Duration(*timeout)*time.Second)
+	if *dad {
+		os.Exit(reportDAD(lookupAddr, answers))
+	}
+	code := report(lookupAddr, answers)
+	if kernelCompare {
+		code = compareKernel(networkInterface, lookupAddr, answers, code, *install)
 	}
+	os.Exit(code)
+}
 
-	// Build destination mac
-	dMac := net.HardwareAddr{0x33, 0x33, dAddr[12], dAddr[13], dAddr[14], dAddr[15]}
+// Build the ethernet frame of a neighbor solicitation for target
+func buildSolicitation(iface *net.Interface, src, dst net.IP, dMac net.HardwareAddr, target net.IP) []byte {
 	// Create new ethernet frame
-	eFrame := NewEthernetFrame(0x86DD, networkInterface.HardwareAddr, dMac)
+	eFrame := NewEthernetFrame(0x86DD, iface.HardwareAddr, dMac)
 
 	// Create icmp payload
 	icmp := ICMPv6NeighborSolicitation{
@@ -72,13 +358,17 @@ func main() {
 			Code:     0x00,
 			Checksum: 0x0,
 		},
-		Reserved:     0x0,
-		OptionType:   0x01,
-		OptionLength: 0x01,
+		Reserved: 0x0,
 	}
 	// Copy target address
-	copy(icmp.TargetAddress[:], lookupAddr)
-	copy(icmp.SourceLinkAddress[:], networkInterface.HardwareAddr)
+	copy(icmp.TargetAddress[:], target)
+	// The unspecified source must not come with a source link-layer address, RFC 4861 section 7.2.2
+	if !src.IsUnspecified() {
+		icmp.Options = append(icmp.Options, &ICMPv6LinkAddressOption{
+			OptionType: ICMPv6OptionSourceLinkAddress,
+			Addr:       iface.HardwareAddr,
+		})
+	}
 
 	// Create IPv6 Packet
 	ipHeader := IPv6Header{
@@ -88,80 +378,255 @@ func main() {
 		PayloadLen:   len(icmp.Marshal()),
 		NextHeader:   0x3a,
 		HopLimit:     0xff,
-		Src:          sAddr,
-		Dst:          dAddr,
+		Src:          src,
+		Dst:          dst,
 	}
 	// Calculate and set icmp checksum
-	icmp.Header.Checksum = ICMPv6Checksum(ipHeader, icmp)
+	icmp.Header.Checksum = ICMPv6Checksum(ipHeader, icmp.Marshal())
 	// Get ethernet frame bytes
 	eFrameBytes := eFrame.Marshal()
 	// Append IPv6 header
 	data := append(eFrameBytes, ipHeader.Marshal()...)
 	data = append(data, icmp.Marshal()...)
-	// Make socket address
-	sockAddr := syscall.SockaddrLinklayer{
-		Protocol: htons(syscall.ETH_P_ALL),
-		Ifindex:  networkInterface.Index,
-	}
-	// Send data
-	err = syscall.Sendto(socket, data, 0, &sockAddr)
-	if err != nil {
-		panic(err)
-	}
+	return data
+}
 
-	// Concurrency patterns : http://blog.golang.org/go-concurrency-patterns-timing-out-and
+// Send a solicitation and retransmit it until the first answer, up to tries times spaced by retransTimer, RFC 4861
+// section 7.2.2. The first answer starts a window of collectTime in which further answers are collected. Gives up
+// after timeout and returns the answers.
+func collectAnswers(send func(), dataIn <-chan *answer, tries int, retransTimer, collectTime, timeout time.Duration) []*answer {
+	timedout := time.After(timeout)
+	send()
+	retransmit := time.NewTicker(retransTimer)
+	defer retransmit.Stop()
+	sent := 1
+	// Started by the first answer, until then further answers are collected
+	var collect <-chan time.Time
+	var answers []*answer
+	for {
+		select {
+		case a := <-dataIn:
+			answers = append(answers, a)
+			if collect == nil {
+				retransmit.Stop()
+				collect = time.After(collectTime)
+			}
+		case <-retransmit.C:
+			// The last solicitation is given one more RetransTimer to be answered
+			if sent >= tries {
+				return answers
+			}
+			send()
+			sent++
+		case <-collect:
+			return answers
+		case <-timedout:
+			return answers
+		}
+	}
+}
 
-	// Signalling channel
-	timedout := make(chan bool, 1)
-	go func() {
-		time.Sleep(time.Duration(*timeout) * time.Second)
-		timedout <- true
-	}()
+// The distinct answers, one per MAC address, and the exit code of the lookup
+func lookupResult(answers []*answer) ([]*answer, int) {
+	// The same neighbor may answer several solicitations
+	var distinct []*answer
+	seen := make(map[string]bool)
+	for _, a := range answers {
+		mac, _ := a.Mac()
+		if !seen[mac.String()] {
+			seen[mac.String()] = true
+			distinct = append(distinct, a)
+		}
+	}
+	switch {
+	case len(distinct) == 0:
+		return nil, exitNoAnswer
+	case len(distinct) > 1:
+		return distinct, exitConflict
+	}
+	return distinct, exitResolved
+}
 
-	// Data channel
-	dataIn := make(chan *ICMPv6NeighborAdvertisement, 1)
+// Print every MAC address that answered for target and return the exit code
+func report(target net.IP, answers []*answer) int {
+	distinct, code := lookupResult(answers)
+	if code == exitNoAnswer {
+		fmt.Println("Message timed out")
+		return code
+	}
+	for _, a := range distinct {
+		fmt.Printf("%s is at %s\n", target.String(), a)
+	}
+	if code == exitConflict {
+		fmt.Printf("Conflict: %d different MAC addresses claim %s\n", len(distinct), target.String())
+	}
+	return code
+}
 
-	// Create socket, taken from http://www.darkcoding.net/software/raw-sockets-in-go-link-layer/
-	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
-	defer f.Close()
+// Print whether target is in use and return the exit code
+func reportDAD(target net.IP, answers []*answer) int {
+	if len(answers) == 0 {
+		fmt.Printf("%s is free\n", target.String())
+		return exitFree
+	}
+	for _, a := range answers {
+		fmt.Printf("%s is in use by %s\n", target.String(), a)
+	}
+	return exitInUse
+}
 
-	// package parsing
-	go func() {
-		// Adapted from http://www.darkcoding.net/software/raw-sockets-in-go-link-layer/
-		for {
-			b := make([]byte, 1024)
-			numRead, err := f.Read(b)
-			if err != nil {
-				panic(err)
-			}
-			eFrame, err := EthernetFrameParse(b[:EthernetFrameLen])
-			// only ipv6 and only for the choosen interface
-			if eFrame.Ethertype == 0x86DD && bytes.Equal(eFrame.DstMac[:], networkInterface.HardwareAddr) {
-				// Parse ipv6 package
-				offset := binary.Size(eFrame)
-				header, err := IPv6ParseHeader(b[offset:numRead])
-				if err == nil && header != nil && header.NextHeader == 0x3a && header.HopLimit == 0xff {
-					// increase offset
-					offset += IPv6HeaderLen
-					// try to parse neighbor advertisement
-					na, err := ICMPv6ParseNeighborAdvertisement(b[offset:numRead])
-					if err == nil {
-						// Put message into channel
-						dataIn <- na
-					}
+// Send count unicast solicitations to target, 0 until interrupted, and print the round-trip time of each answer.
+// Returns exitResolved if the neighbor answered at least once.
+func probe(target net.IP, mac net.HardwareAddr, send func(), dataIn <-chan *answer, interval time.Duration, count int) int {
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	stats := new(probeStats)
+	for stop := false; !stop && (count == 0 || stats.sent < count); {
+		stats.Sent(time.Now())
+		send()
+		next := time.After(interval)
+		for waiting := true; waiting; {
+			select {
+			case a := <-dataIn:
+				rtt, ok := stats.Reply(a.Time)
+				if !ok {
+					continue
+				}
+				fmt.Printf("reply from %s: seq=%d time=%.3f ms %s", target.String(), stats.sent, float64(rtt)/float64(time.Millisecond), a)
+				if answered, _ := a.Mac(); !bytes.Equal(answered, mac) {
+					fmt.Printf(" (MAC address changed from %s)", mac)
 				}
+				fmt.Println()
+			case <-next:
+				waiting = false
+			case <-interrupted:
+				waiting = false
+				stop = true
 			}
 		}
-	}()
+		if !stats.replied && !stop {
+			fmt.Printf("no reply from %s: seq=%d\n", target.String(), stats.sent)
+		}
+	}
+	// Summary like ping
+	fmt.Printf("--- %s neighbor unreachability detection ---\n", target.String())
+	fmt.Print(stats)
+	if len(stats.rtts) == 0 {
+		return exitNoAnswer
+	}
+	return exitResolved
+}
 
-	select {
-	case m := <-dataIn:
-		mac := strings.Replace(fmt.Sprintf("% x", m.SourceLinkAddress), " ", ":", -1)
-		fmt.Printf("%s is at %s\n", lookupAddr.String(), mac)
-	case <-timedout:
-		fmt.Println("Message timed out")
-		return
+// Round-trip times of the probes of -nud, each probe is answered by the first reply after it was sent
+type probeStats struct {
+	sent    int
+	start   time.Time // of the last probe
+	replied bool      // the last probe was answered
+	rtts    []time.Duration
+}
+
+// Count a probe sent at start
+func (s *probeStats) Sent(start time.Time) {
+	s.sent++
+	s.start = start
+	s.replied = false
+}
+
+// Account a reply received at t and return its round-trip time. Late answers to an earlier probe and duplicates
+// are ignored.
+func (s *probeStats) Reply(t time.Time) (time.Duration, bool) {
+	if s.sent == 0 || s.replied || t.Before(s.start) {
+		return 0, false
+	}
+	s.replied = true
+	rtt := t.Sub(s.start)
+	s.rtts = append(s.rtts, rtt)
+	return rtt, true
+}
+
+// Loss in percent of the probes sent
+func (s *probeStats) Loss() float64 {
+	if s.sent == 0 {
+		return 0
+	}
+	return 100 * float64(s.sent-len(s.rtts)) / float64(s.sent)
+}
+
+// Minimum, average and maximum round-trip time, all 0 without replies
+func (s *probeStats) MinAvgMax() (min, avg, max time.Duration) {
+	if len(s.rtts) == 0 {
+		return 0, 0, 0
+	}
+	min, max = s.rtts[0], s.rtts[0]
+	var sum time.Duration
+	for _, rtt := range s.rtts {
+		if rtt < min {
+			min = rtt
+		}
+		if rtt > max {
+			max = rtt
+		}
+		sum += rtt
+	}
+	return min, sum / time.Duration(len(s.rtts)), max
+}
+
+// Summary lines like ping prints them
+func (s *probeStats) String() string {
+	str := fmt.Sprintf("%d probes sent, %d replies, %.0f%% loss\n", s.sent, len(s.rtts), s.Loss())
+	if len(s.rtts) == 0 {
+		return str
+	}
+	min, avg, max := s.MinAvgMax()
+	ms := float64(time.Millisecond)
+	return str + fmt.Sprintf("rtt min/avg/max = %.3f/%.3f/%.3f ms\n", float64(min)/ms, float64(avg)/ms, float64(max)/ms)
+}
+
+// A valid neighbor advertisement, or a competing duplicate address detection solicitation in -dad mode,
+// or the ARP packet of an IPv4 target, together with the ethernet source of its frame
+type answer struct {
+	NA       *ICMPv6NeighborAdvertisement
+	NS       *ICMPv6NeighborSolicitation
+	ARP      *ARPPacket // reply, gratuitous ARP or competing probe for IPv4 targets
+	EtherSrc net.HardwareAddr
+	Time     time.Time // when the frame was read
+}
+
+// The link-layer address of the target, from the option or the ethernet source
+func (a *answer) Mac() (mac net.HardwareAddr, fromOption bool) {
+	if a.ARP != nil {
+		return net.HardwareAddr(a.ARP.SenderMac[:]), true
+	}
+	if a.NA != nil {
+		if mac = a.NA.TargetLinkAddress(); mac != nil {
+			return mac, true
+		}
+	}
+	return a.EtherSrc, false
+}
+
+// MAC and R/S/O flags
+func (a *answer) String() string {
+	mac, fromOption := a.Mac()
+	s := mac.String()
+	if a.NS != nil {
+		return s + " (duplicate address detection in progress)"
+	}
+	if a.ARP != nil {
+		if a.ARP.IsProbe() {
+			s += " (address conflict detection in progress)"
+		} else if a.ARP.IsGratuitous() {
+			s += " (gratuitous ARP)"
+		}
+		if !bytes.Equal(a.EtherSrc, mac) {
+			s += fmt.Sprintf(" (ethernet source %s)", a.EtherSrc)
+		}
+		return s
+	}
+	if !fromOption {
+		s += " (ethernet source, no target link-layer address option)"
 	}
+	return fmt.Sprintf("%s router=%t solicited=%t override=%t", s, a.NA.FlagSet(ICMPv6NeighborAdvertisementFlagR), a.NA.FlagSet(ICMPv6NeighborAdvertisementFlagS), a.NA.FlagSet(ICMPv6NeighborAdvertisementFlagO))
 }
 
 func getSrcAddr(iface *net.Interface) (src net.IP) {
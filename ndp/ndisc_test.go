@@ -0,0 +1,121 @@
+// +build linux
+
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// An advertisement from the neighbor at mac
+func testAnswer(mac string) *answer {
+	m, _ := net.ParseMAC(mac)
+	na := &ICMPv6NeighborAdvertisement{
+		Header:  ICMPv6MessageHeader{Type: 0x88},
+		Options: []ICMPv6Option{&ICMPv6LinkAddressOption{OptionType: ICMPv6OptionTargetLinkAddress, Addr: m}},
+	}
+	na.SetFlags(ICMPv6NeighborAdvertisementFlagS)
+	return &answer{NA: na, EtherSrc: m, Time: time.Now()}
+}
+
+func TestLookupResult(t *testing.T) {
+	a := testAnswer("02:00:00:00:00:01")
+	b := testAnswer("02:00:00:00:00:02")
+	tests := []struct {
+		name     string
+		answers  []*answer
+		distinct int
+		code     int
+	}{
+		{"no answer", nil, 0, exitNoAnswer},
+		{"one", []*answer{a}, 1, exitResolved},
+		{"one repeated", []*answer{a, a, a}, 1, exitResolved},
+		{"several", []*answer{a, b, a}, 2, exitConflict},
+	}
+	for _, test := range tests {
+		distinct, code := lookupResult(test.answers)
+		if len(distinct) != test.distinct || code != test.code {
+			t.Errorf("%s: expected %d answers and exit code %d, got %d and %d", test.name, test.distinct, test.code, len(distinct), code)
+		}
+	}
+}
+
+func TestCollectAnswers(t *testing.T) {
+	a := testAnswer("02:00:00:00:00:01")
+	b := testAnswer("02:00:00:00:00:02")
+	retransTimer := 10 * time.Millisecond
+	tests := []struct {
+		name string
+		// answers to the solicitation with the given number
+		answers map[int][]*answer
+		tries   int
+		timeout time.Duration
+		sent    int
+		code    int
+	}{
+		{"no answer", nil, 3, time.Second, 3, exitNoAnswer},
+		{"cut off by timeout", nil, 100, 35 * time.Millisecond, 4, exitNoAnswer},
+		{"first answered", map[int][]*answer{1: {a}}, 3, time.Second, 1, exitResolved},
+		{"second answered", map[int][]*answer{2: {a}}, 3, time.Second, 2, exitResolved},
+		{"collected", map[int][]*answer{1: {a, a, b}}, 3, time.Second, 1, exitConflict},
+	}
+	for _, test := range tests {
+		dataIn := make(chan *answer, 4)
+		sent := 0
+		send := func() {
+			sent++
+			for _, a := range test.answers[sent] {
+				dataIn <- a
+			}
+		}
+		answers := collectAnswers(send, dataIn, test.tries, retransTimer, 5*retransTimer, test.timeout)
+		// the timeout races with the ticker
+		if sent != test.sent && !(test.timeout < time.Second && sent > 1 && sent < test.tries) {
+			t.Errorf("%s: expected %d solicitations, sent %d", test.name, test.sent, sent)
+		}
+		if _, code := lookupResult(answers); code != test.code {
+			t.Errorf("%s: expected exit code %d, got %d", test.name, test.code, code)
+		}
+	}
+}
+
+func TestProbeStats(t *testing.T) {
+	ms := time.Millisecond
+	start := time.Now()
+	// at returns the time offset ms after the start
+	at := func(offset int) time.Time { return start.Add(time.Duration(offset) * ms) }
+	type event struct {
+		probe bool // probe sent or reply received
+		at    int
+	}
+	tests := []struct {
+		name          string
+		events        []event
+		replies       int
+		loss          float64
+		min, avg, max time.Duration
+	}{
+		{"all answered", []event{{true, 0}, {false, 2}, {true, 1000}, {false, 1004}}, 2, 0, 2 * ms, 3 * ms, 4 * ms},
+		{"lost probe", []event{{true, 0}, {false, 3}, {true, 1000}, {true, 2000}, {false, 2001}}, 2, 100.0 / 3, ms, 2 * ms, 3 * ms},
+		{"all lost", []event{{true, 0}, {true, 1000}, {true, 2000}}, 0, 100, 0, 0, 0},
+		{"duplicate", []event{{true, 0}, {false, 2}, {false, 3}}, 1, 0, 2 * ms, 2 * ms, 2 * ms},
+		// the late reply to the first probe is read after the second probe was sent
+		{"out of order", []event{{true, 0}, {true, 1000}, {false, 999}, {false, 1005}}, 1, 50, 5 * ms, 5 * ms, 5 * ms},
+		{"reply before probe", []event{{false, 0}, {true, 1}}, 0, 100, 0, 0, 0},
+	}
+	for _, test := range tests {
+		s := new(probeStats)
+		for _, e := range test.events {
+			if e.probe {
+				s.Sent(at(e.at))
+			} else {
+				s.Reply(at(e.at))
+			}
+		}
+		min, avg, max := s.MinAvgMax()
+		if len(s.rtts) != test.replies || s.Loss() != test.loss || min != test.min || avg != test.avg || max != test.max {
+			t.Errorf("%s: got %d replies, %.1f%% loss, rtt %s/%s/%s", test.name, len(s.rtts), s.Loss(), min, avg, max)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// New and changed bindings are saved at most this often, a flood of them must not rewrite the state file for every
+// message
+const changedSaveInterval = 5 * time.Second
+
+// Last seen times are saved at most this often
+const touchedSaveInterval = time.Minute
+
+// Record every binding seen on iface in stateFile and report suspicious ones, runs until it is killed. The
+// interface is put into promiscuous mode: solicited advertisements are unicast and solicitations go to the
+// solicited-node groups of others, neither reaches us otherwise. On a switched network the monitor still needs
+// a mirror port to see the traffic between other hosts.
+func ndpmon(iface *net.Interface, stateFile string, verbose bool) int {
+	d, err := loadDetector(stateFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read %s.\n%s\n", stateFile, err.Error())
+		return exitNoAnswer
+	}
+	socket, err := openPacketSocket(iface)
+	if err != nil {
+		panic(err)
+	}
+	if err := addMembership(socket, iface, syscall.PACKET_MR_PROMISC, nil); err != nil {
+		panic(err)
+	}
+	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
+	defer f.Close()
+
+	// The state file is saved in the background and once more when the monitor is stopped, the mutex guards d
+	var mutex sync.Mutex
+	go func() {
+		stopped := make(chan os.Signal, 1)
+		signal.Notify(stopped, os.Interrupt, syscall.SIGTERM)
+		ticker := time.NewTicker(changedSaveInterval)
+		lastSave := time.Now()
+		for {
+			var now time.Time
+			stop := false
+			select {
+			case now = <-ticker.C:
+			case <-stopped:
+				now, stop = time.Now(), true
+			}
+			mutex.Lock()
+			if d.changed || d.touched && (stop || now.Sub(lastSave) >= touchedSaveInterval) {
+				if err := d.Save(stateFile); err != nil {
+					fmt.Fprintf(os.Stderr, "Unable to write %s.\n%s\n", stateFile, err.Error())
+				}
+				lastSave = now
+			}
+			if stop {
+				os.Exit(exitResolved)
+			}
+			mutex.Unlock()
+		}
+	}()
+	readICMPv6(f, iface, verbose, []byte{0x85, 0x86, 0x87, 0x88}, func(etherSrc net.HardwareAddr, header *IPv6Header, b []byte) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events, err := d.Check(etherSrc, header, b, time.Now())
+		if err != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped ICMPv6 type %d from %s: %s\n", b[0], header.Src, err.Error())
+			}
+			return
+		}
+		for _, e := range events {
+			fmt.Println(e)
+		}
+	})
+	return exitResolved
+}
@@ -0,0 +1,423 @@
+// Package neighbor implements the neighbor cache of RFC 4861 section 7.3 for userspace tools.
+//
+// The cache does not touch the network itself. A Transport sends the neighbor solicitations, and the caller
+// passes received advertisements and solicitations to HandleAdvertisement and HandleSolicitation.
+package neighbor
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Reachability state of a neighbor cache entry
+type State int
+
+const (
+	Incomplete State = iota // address resolution in progress
+	Reachable               // recently confirmed
+	Stale                   // unconfirmed, usable until traffic is sent
+	Delay                   // traffic was sent, waiting for an upper layer confirmation
+	Probe                   // unicast solicitations are sent
+)
+
+func (s State) String() string {
+	switch s {
+	case Incomplete:
+		return "INCOMPLETE"
+	case Reachable:
+		return "REACHABLE"
+	case Stale:
+		return "STALE"
+	case Delay:
+		return "DELAY"
+	case Probe:
+		return "PROBE"
+	}
+	return "UNKNOWN"
+}
+
+// Protocol constants, RFC 4861 section 10
+const (
+	MaxMulticastSolicit = 3
+	MaxUnicastSolicit   = 3
+	ReachableTime       = 30 * time.Second
+	RetransTimer        = time.Second
+	DelayFirstProbeTime = 5 * time.Second
+)
+
+// ErrUnreachable is returned to lookups of neighbors that did not answer
+var ErrUnreachable = errors.New("neighbor is unreachable")
+
+// ErrClosed is returned to lookups that were pending when the cache was closed
+var ErrClosed = errors.New("neighbor cache is closed")
+
+// Transport sends neighbor solicitations for the cache
+type Transport interface {
+	// Solicit sends a neighbor solicitation for target. It is multicast to the solicited-node group of target
+	// if mac is nil, otherwise unicast to mac.
+	Solicit(target net.IP, mac net.HardwareAddr) error
+}
+
+// Config holds the timers and retransmission limits, zero values are replaced by the protocol constants
+type Config struct {
+	MaxMulticastSolicit int
+	MaxUnicastSolicit   int
+	ReachableTime       time.Duration
+	RetransTimer        time.Duration
+	DelayFirstProbeTime time.Duration
+}
+
+// Entry is a snapshot of a neighbor cache entry
+type Entry struct {
+	IP       net.IP
+	Mac      net.HardwareAddr // nil while Incomplete
+	State    State
+	IsRouter bool
+	Updated  time.Time // last state change
+}
+
+// StateFunc is called after an entry changed its state. New entries are reported with old set to their
+// state, an entry that is removed from the cache is reported with its last state and removed set.
+type StateFunc func(e Entry, old State, removed bool)
+
+type entry struct {
+	Entry
+	// solicitations sent in the current state
+	solicits int
+	timer    *time.Timer
+	// increased with every state change, timers of earlier states are ignored
+	generation int
+	// lookups waiting for resolution
+	waiting []func(net.HardwareAddr, error)
+}
+
+// Cache is a neighbor cache, it is safe for concurrent use
+type Cache struct {
+	mu        sync.Mutex
+	transport Transport
+	config    Config
+	entries   map[string]*entry
+	onChange  StateFunc
+	closed    bool
+	// run after the lock is released: callbacks, lookup results and solicitations
+	after []func()
+}
+
+// New creates a cache that sends solicitations with t. config may be nil to use the protocol constants.
+func New(t Transport, config *Config) *Cache {
+	c := &Cache{
+		transport: t,
+		entries:   make(map[string]*entry),
+	}
+	if config != nil {
+		c.config = *config
+	}
+	if c.config.MaxMulticastSolicit <= 0 {
+		c.config.MaxMulticastSolicit = MaxMulticastSolicit
+	}
+	if c.config.MaxUnicastSolicit <= 0 {
+		c.config.MaxUnicastSolicit = MaxUnicastSolicit
+	}
+	if c.config.ReachableTime <= 0 {
+		c.config.ReachableTime = ReachableTime
+	}
+	if c.config.RetransTimer <= 0 {
+		c.config.RetransTimer = RetransTimer
+	}
+	if c.config.DelayFirstProbeTime <= 0 {
+		c.config.DelayFirstProbeTime = DelayFirstProbeTime
+	}
+	return c
+}
+
+// OnStateChange sets the callback for state changes. It runs without the cache being locked, so it may call
+// the cache.
+func (c *Cache) OnStateChange(f StateFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChange = f
+}
+
+// Release the lock and run what was deferred while holding it
+func (c *Cache) unlock() {
+	after := c.after
+	c.after = nil
+	c.mu.Unlock()
+	for _, f := range after {
+		f()
+	}
+}
+
+// Resolve calls done with the link-layer address of ip as soon as it is known, or with ErrUnreachable once
+// resolution failed. Using a STALE entry starts unreachability detection as described in RFC 4861 section 7.3.3.
+func (c *Cache) Resolve(ip net.IP, done func(net.HardwareAddr, error)) {
+	c.mu.Lock()
+	defer c.unlock()
+	if c.closed {
+		c.after = append(c.after, func() { done(nil, ErrClosed) })
+		return
+	}
+	e, ok := c.entries[ip.String()]
+	if !ok {
+		// start address resolution
+		e = &entry{Entry: Entry{IP: ip, State: Incomplete, Updated: time.Now()}}
+		c.entries[ip.String()] = e
+		c.changed(e, Incomplete)
+		c.solicit(e)
+	}
+	if e.State == Incomplete {
+		e.waiting = append(e.waiting, done)
+		return
+	}
+	if e.State == Stale {
+		c.setState(e, Delay)
+	}
+	mac := e.Mac
+	c.after = append(c.after, func() { done(mac, nil) })
+}
+
+// Lookup blocks until the link-layer address of ip is known or resolution failed
+func (c *Cache) Lookup(ip net.IP) (net.HardwareAddr, error) {
+	type result struct {
+		mac net.HardwareAddr
+		err error
+	}
+	ch := make(chan result, 1)
+	c.Resolve(ip, func(mac net.HardwareAddr, err error) {
+		ch <- result{mac, err}
+	})
+	r := <-ch
+	return r.mac, r.err
+}
+
+// Confirm reports reachability from an upper layer, e.g. a TCP acknowledgement, RFC 4861 section 7.3.1
+func (c *Cache) Confirm(ip net.IP) {
+	c.mu.Lock()
+	defer c.unlock()
+	if e, ok := c.entries[ip.String()]; ok && e.State != Incomplete {
+		c.setState(e, Reachable)
+	}
+}
+
+// HandleAdvertisement updates the cache with a received and validated neighbor advertisement for target.
+// mac is the target link-layer address option, or nil if there was none. See RFC 4861 section 7.2.5.
+func (c *Cache) HandleAdvertisement(target net.IP, mac net.HardwareAddr, solicited, override, router bool) {
+	c.mu.Lock()
+	defer c.unlock()
+	e, ok := c.entries[target.String()]
+	if !ok || c.closed {
+		// advertisements never create entries
+		return
+	}
+	if e.State == Incomplete {
+		if mac == nil {
+			return
+		}
+		e.Mac = mac
+		e.IsRouter = router
+		if solicited {
+			c.setState(e, Reachable)
+		} else {
+			c.setState(e, Stale)
+		}
+		c.resolved(e)
+		return
+	}
+	differs := mac != nil && !bytes.Equal(mac, e.Mac)
+	if !override && differs {
+		// keep the known address, but it is not trusted anymore
+		if e.State == Reachable {
+			c.setState(e, Stale)
+		}
+		return
+	}
+	if mac != nil {
+		e.Mac = mac
+	}
+	e.IsRouter = router
+	if solicited {
+		c.setState(e, Reachable)
+	} else if differs {
+		c.setState(e, Stale)
+	}
+}
+
+// HandleSolicitation updates the cache with a received and validated neighbor solicitation from src with the
+// source link-layer address mac, see RFC 4861 section 7.2.3.
+func (c *Cache) HandleSolicitation(src net.IP, mac net.HardwareAddr) {
+	c.mu.Lock()
+	defer c.unlock()
+	if mac == nil || src.IsUnspecified() || c.closed {
+		return
+	}
+	e, ok := c.entries[src.String()]
+	if !ok {
+		e = &entry{Entry: Entry{IP: src, Mac: mac, State: Stale, Updated: time.Now()}}
+		c.entries[src.String()] = e
+		c.changed(e, Stale)
+		return
+	}
+	if e.State == Incomplete {
+		e.Mac = mac
+		c.setState(e, Stale)
+		c.resolved(e)
+		return
+	}
+	if !bytes.Equal(mac, e.Mac) {
+		e.Mac = mac
+		c.setState(e, Stale)
+	}
+}
+
+// Entries returns a snapshot of all entries
+func (c *Cache) Entries() []Entry {
+	c.mu.Lock()
+	defer c.unlock()
+	entries := make([]Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e.Entry)
+	}
+	return entries
+}
+
+// Remove deletes the entry of ip, pending lookups fail
+func (c *Cache) Remove(ip net.IP) {
+	c.mu.Lock()
+	defer c.unlock()
+	if e, ok := c.entries[ip.String()]; ok {
+		c.remove(e, ErrUnreachable)
+	}
+}
+
+// Close stops all timers and fails the pending lookups
+func (c *Cache) Close() {
+	c.mu.Lock()
+	defer c.unlock()
+	c.closed = true
+	for _, e := range c.entries {
+		if e.timer != nil {
+			e.timer.Stop()
+		}
+		c.fail(e, ErrClosed)
+	}
+}
+
+// Change the state of e and start the timer of the new state
+func (c *Cache) setState(e *entry, state State) {
+	old := e.State
+	e.State = state
+	e.Updated = time.Now()
+	e.solicits = 0
+	e.generation++
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	switch state {
+	case Reachable:
+		c.startTimer(e, c.config.ReachableTime)
+	case Delay:
+		c.startTimer(e, c.config.DelayFirstProbeTime)
+	case Probe:
+		c.solicit(e)
+	}
+	if old != state {
+		c.changed(e, old)
+	}
+}
+
+func (c *Cache) startTimer(e *entry, d time.Duration) {
+	ip := e.IP.String()
+	generation := e.generation
+	e.timer = time.AfterFunc(d, func() {
+		c.timeout(ip, generation)
+	})
+}
+
+// Send a solicitation for e and wait RetransTimer for the answer
+func (c *Cache) solicit(e *entry) {
+	e.solicits++
+	ip, mac := e.IP, e.Mac
+	if e.State == Incomplete {
+		mac = nil
+	}
+	c.after = append(c.after, func() {
+		// a lost solicitation is handled like an unanswered one
+		c.transport.Solicit(ip, mac)
+	})
+	c.startTimer(e, c.config.RetransTimer)
+}
+
+// Timer of an entry expired
+func (c *Cache) timeout(ip string, generation int) {
+	c.mu.Lock()
+	defer c.unlock()
+	e, ok := c.entries[ip]
+	if !ok || e.generation != generation || c.closed {
+		return
+	}
+	e.timer = nil
+	switch e.State {
+	case Reachable:
+		c.setState(e, Stale)
+	case Delay:
+		c.setState(e, Probe)
+	case Incomplete:
+		if e.solicits < c.config.MaxMulticastSolicit {
+			c.solicit(e)
+		} else {
+			c.remove(e, ErrUnreachable)
+		}
+	case Probe:
+		if e.solicits < c.config.MaxUnicastSolicit {
+			c.solicit(e)
+		} else {
+			c.remove(e, ErrUnreachable)
+		}
+	}
+}
+
+// Delete e from the cache
+func (c *Cache) remove(e *entry, err error) {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	e.generation++
+	delete(c.entries, e.IP.String())
+	c.fail(e, err)
+	if f := c.onChange; f != nil {
+		snapshot := e.Entry
+		c.after = append(c.after, func() { f(snapshot, snapshot.State, true) })
+	}
+}
+
+// Pass the address of e to the waiting lookups
+func (c *Cache) resolved(e *entry) {
+	mac := e.Mac
+	for _, done := range e.waiting {
+		done := done
+		c.after = append(c.after, func() { done(mac, nil) })
+	}
+	e.waiting = nil
+}
+
+// Fail the waiting lookups of e
+func (c *Cache) fail(e *entry, err error) {
+	for _, done := range e.waiting {
+		done := done
+		c.after = append(c.after, func() { done(nil, err) })
+	}
+	e.waiting = nil
+}
+
+// Report a state change
+func (c *Cache) changed(e *entry, old State) {
+	if f := c.onChange; f != nil {
+		snapshot := e.Entry
+		c.after = append(c.after, func() { f(snapshot, old, false) })
+	}
+}
@@ -0,0 +1,156 @@
+package neighbor
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// records the solicitations instead of sending them
+type fakeTransport struct {
+	mu        sync.Mutex
+	multicast int
+	unicast   int
+}
+
+func (t *fakeTransport) Solicit(target net.IP, mac net.HardwareAddr) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if mac == nil {
+		t.multicast++
+	} else {
+		t.unicast++
+	}
+	return nil
+}
+
+func (t *fakeTransport) counts() (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.multicast, t.unicast
+}
+
+var testConfig = &Config{
+	ReachableTime:       30 * time.Millisecond,
+	RetransTimer:        10 * time.Millisecond,
+	DelayFirstProbeTime: 20 * time.Millisecond,
+}
+
+func state(c *Cache, ip net.IP) (State, bool) {
+	for _, e := range c.Entries() {
+		if e.IP.Equal(ip) {
+			return e.State, true
+		}
+	}
+	return 0, false
+}
+
+func TestResolve(t *testing.T) {
+	transport := &fakeTransport{}
+	c := New(transport, testConfig)
+	defer c.Close()
+	ip := net.ParseIP("fd01::2")
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	var changes []State
+	var mu sync.Mutex
+	c.OnStateChange(func(e Entry, old State, removed bool) {
+		mu.Lock()
+		changes = append(changes, e.State)
+		mu.Unlock()
+	})
+	go func() {
+		time.Sleep(15 * time.Millisecond)
+		c.HandleAdvertisement(ip, mac, true, true, false)
+	}()
+	got, err := c.Lookup(ip)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if got.String() != mac.String() {
+		t.Errorf("Resolved %s, expected %s", got, mac)
+	}
+	if s, _ := state(c, ip); s != Reachable {
+		t.Errorf("State is %s, expected REACHABLE", s)
+	}
+	if multicast, _ := transport.counts(); multicast != 2 {
+		t.Errorf("Sent %d multicast solicitations, expected 2", multicast)
+	}
+	// REACHABLE times out to STALE, using it starts DELAY and then PROBE
+	time.Sleep(40 * time.Millisecond)
+	if s, _ := state(c, ip); s != Stale {
+		t.Fatalf("State is %s, expected STALE", s)
+	}
+	if _, err := c.Lookup(ip); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s, _ := state(c, ip); s != Delay {
+		t.Fatalf("State is %s, expected DELAY", s)
+	}
+	time.Sleep(25 * time.Millisecond)
+	if s, _ := state(c, ip); s != Probe {
+		t.Fatalf("State is %s, expected PROBE", s)
+	}
+	c.HandleAdvertisement(ip, nil, true, false, false)
+	if s, _ := state(c, ip); s != Reachable {
+		t.Fatalf("State is %s, expected REACHABLE", s)
+	}
+	if _, unicast := transport.counts(); unicast != 1 {
+		t.Errorf("Sent %d unicast solicitations, expected 1", unicast)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []State{Incomplete, Reachable, Stale, Delay, Probe, Reachable}
+	if len(changes) != len(expected) {
+		t.Fatalf("State changes %v, expected %v", changes, expected)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("State changes %v, expected %v", changes, expected)
+		}
+	}
+}
+
+func TestResolveUnreachable(t *testing.T) {
+	transport := &fakeTransport{}
+	c := New(transport, testConfig)
+	defer c.Close()
+	ip := net.ParseIP("fd01::3")
+	if _, err := c.Lookup(ip); err != ErrUnreachable {
+		t.Errorf("Lookup returned %v, expected ErrUnreachable", err)
+	}
+	if multicast, _ := transport.counts(); multicast != MaxMulticastSolicit {
+		t.Errorf("Sent %d multicast solicitations, expected %d", multicast, MaxMulticastSolicit)
+	}
+	if _, ok := state(c, ip); ok {
+		t.Error("Unreachable entry was kept")
+	}
+}
+
+func TestAdvertisementOverride(t *testing.T) {
+	c := New(&fakeTransport{}, testConfig)
+	defer c.Close()
+	ip := net.ParseIP("fd01::2")
+	a, _ := net.ParseMAC("02:00:00:00:00:01")
+	b, _ := net.ParseMAC("02:00:00:00:00:02")
+	// advertisements don't create entries, solicitations do
+	c.HandleAdvertisement(ip, a, false, true, false)
+	if _, ok := state(c, ip); ok {
+		t.Fatal("Advertisement created an entry")
+	}
+	c.HandleSolicitation(ip, a)
+	c.Confirm(ip)
+	// a different address without override only makes the entry STALE
+	c.HandleAdvertisement(ip, b, false, false, false)
+	if s, _ := state(c, ip); s != Stale {
+		t.Errorf("State is %s, expected STALE", s)
+	}
+	if mac, _ := c.Lookup(ip); mac.String() != a.String() {
+		t.Errorf("Address changed to %s without override", mac)
+	}
+	c.HandleAdvertisement(ip, b, false, true, true)
+	entries := c.Entries()
+	if len(entries) != 1 || entries[0].Mac.String() != b.String() || entries[0].State != Stale || !entries[0].IsRouter {
+		t.Errorf("Override was not applied: %v", entries)
+	}
+}
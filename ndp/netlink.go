@@ -0,0 +1,150 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Address family of ip for rtnetlink
+func addressFamily(ip net.IP) uint8 {
+	if ip.To4() != nil {
+		return syscall.AF_INET
+	}
+	return syscall.AF_INET6
+}
+
+// Read the kernel neighbor entry of ip on iface over rtnetlink (RTM_GETNEIGH), nil if there is none
+func kernelLookup(iface *net.Interface, ip net.IP) (*kernelNeighbor, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, int(addressFamily(ip)))
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH {
+			continue
+		}
+		n, err := parseNeighborMessage(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		if n.Ifindex == iface.Index && n.IP.Equal(ip) {
+			return n, nil
+		}
+	}
+	return nil, nil
+}
+
+// Set the kernel neighbor entry of ip on iface to mac with state (RTM_NEWNEIGH), an existing entry is replaced
+func kernelInstall(iface *net.Interface, ip net.IP, mac net.HardwareAddr, state uint16, router bool) error {
+	socket, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(socket)
+	if err := syscall.Bind(socket, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+	body := neighborRequest(addressFamily(ip), iface.Index, ip, mac, state, router)
+	header := syscall.NlMsghdr{
+		Len:   uint32(syscall.NLMSG_HDRLEN + len(body)),
+		Type:  syscall.RTM_NEWNEIGH,
+		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_ACK | syscall.NLM_F_CREATE | syscall.NLM_F_REPLACE,
+		Seq:   1,
+	}
+	var buffer bytes.Buffer
+	buffer.Write((*[syscall.NLMSG_HDRLEN]byte)(unsafe.Pointer(&header))[:])
+	buffer.Write(body)
+	if err := syscall.Sendto(socket, buffer.Bytes(), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return err
+	}
+	// The acknowledgement is an error message with error code 0
+	b := make([]byte, syscall.Getpagesize())
+	numRead, _, err := syscall.Recvfrom(socket, b, 0)
+	if err != nil {
+		return err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(b[:numRead])
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.NLMSG_ERROR || m.Header.Seq != header.Seq {
+			continue
+		}
+		if len(m.Data) < 4 {
+			return fmt.Errorf("netlink acknowledgement is too short")
+		}
+		if errno := -int32(nativeEndian.Uint32(m.Data[0:4])); errno != 0 {
+			return syscall.Errno(errno)
+		}
+		return nil
+	}
+	return fmt.Errorf("no netlink acknowledgement")
+}
+
+// Print the kernel entry of target next to the answers on the wire and report mismatches. With install set to
+// reachable or permanent, a single answered MAC address is written to the kernel table, otherwise the reason is
+// printed. Returns exitKernel if the table can't be read or written, exitMismatch if the kernel disagrees with the
+// wire, code otherwise.
+func compareKernel(iface *net.Interface, target net.IP, answers []*answer, code int, install string) int {
+	// The same neighbor may answer several times
+	var answered []net.HardwareAddr
+	router := false
+	seen := make(map[string]bool)
+	for _, a := range answers {
+		mac, _ := a.Mac()
+		if !seen[mac.String()] {
+			seen[mac.String()] = true
+			answered = append(answered, mac)
+		}
+		if a.NA != nil && a.NA.FlagSet(ICMPv6NeighborAdvertisementFlagR) {
+			router = true
+		}
+	}
+	entry, err := kernelLookup(iface, target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read the kernel neighbor table.\n%s\n", err.Error())
+		return exitKernel
+	}
+	if entry == nil {
+		fmt.Printf("kernel: no entry for %s on %s\n", target, iface.Name)
+	} else {
+		fmt.Printf("kernel: %s\n", entry)
+	}
+	if mismatch := kernelMismatch(target, entry, answered); mismatch != "" {
+		fmt.Printf("MISMATCH: %s\n", mismatch)
+		if code == exitResolved {
+			code = exitMismatch
+		}
+	}
+	switch {
+	case install == "":
+		return code
+	case len(answered) == 0:
+		fmt.Fprintf(os.Stderr, "Nothing installed for %s: no answer\n", target)
+		return code
+	case len(answered) > 1:
+		fmt.Fprintf(os.Stderr, "Nothing installed for %s: conflicting answers\n", target)
+		return code
+	}
+	state := uint16(nudReachable)
+	if install == "permanent" {
+		state = nudPermanent
+	}
+	if err := kernelInstall(iface, target, answered[0], state, router); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to install the neighbor entry.\n%s\n", err.Error())
+		return exitKernel
+	}
+	fmt.Printf("Installed %s at %s as %s\n", target, answered[0], neighborState(state))
+	return code
+}
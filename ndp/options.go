@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// NDP option types
+const (
+	ICMPv6OptionSourceLinkAddress = 1  // RFC 4861
+	ICMPv6OptionTargetLinkAddress = 2  // RFC 4861
+	ICMPv6OptionPrefixInformation = 3  // RFC 4861
+	ICMPv6OptionRedirectedHeader  = 4  // RFC 4861
+	ICMPv6OptionMTU               = 5  // RFC 4861
+	ICMPv6OptionNonce             = 14 // RFC 3971
+	ICMPv6OptionRouteInformation  = 24 // RFC 4191
+	ICMPv6OptionRDNSS             = 25 // RFC 8106
+	ICMPv6OptionDNSSL             = 31 // RFC 8106
+)
+
+// NDP option (type-length-value, length in units of 8 octets)
+type ICMPv6Option interface {
+	// Option type
+	Type() byte
+	// Returns the option including type, length and padding
+	Marshal() []byte
+	// String representation of the option
+	String() string
+}
+
+// Source or target link-layer address option
+type ICMPv6LinkAddressOption struct {
+	OptionType byte
+	Addr       net.HardwareAddr
+}
+
+func (o *ICMPv6LinkAddressOption) Type() byte {
+	return o.OptionType
+}
+
+func (o *ICMPv6LinkAddressOption) Marshal() []byte {
+	return marshalOption(o.OptionType, o.Addr)
+}
+
+func (o *ICMPv6LinkAddressOption) String() string {
+	if o.OptionType == ICMPv6OptionSourceLinkAddress {
+		return fmt.Sprintf("Source-Link-Address: %s", o.Addr)
+	}
+	return fmt.Sprintf("Target-Link-Address: %s", o.Addr)
+}
+
+// Prefix information option
+type ICMPv6PrefixInformationOption struct {
+	PrefixLength      uint8
+	OnLink            bool // L flag
+	Autonomous        bool // A flag
+	ValidLifetime     uint32
+	PreferredLifetime uint32
+	Prefix            net.IP
+}
+
+func (o *ICMPv6PrefixInformationOption) Type() byte {
+	return ICMPv6OptionPrefixInformation
+}
+
+func (o *ICMPv6PrefixInformationOption) Marshal() []byte {
+	b := make([]byte, 30)
+	b[0] = o.PrefixLength
+	if o.OnLink {
+		b[1] |= 0x80
+	}
+	if o.Autonomous {
+		b[1] |= 0x40
+	}
+	binary.BigEndian.PutUint32(b[2:6], o.ValidLifetime)
+	binary.BigEndian.PutUint32(b[6:10], o.PreferredLifetime)
+	// 4 byte reserved
+	copy(b[14:30], o.Prefix.To16())
+	return marshalOption(ICMPv6OptionPrefixInformation, b)
+}
+
+func (o *ICMPv6PrefixInformationOption) String() string {
+	return fmt.Sprintf("Prefix: %s/%d, L: %t, A: %t, Valid-Lifetime: %d, Preferred-Lifetime: %d", o.Prefix, o.PrefixLength, o.OnLink, o.Autonomous, o.ValidLifetime, o.PreferredLifetime)
+}
+
+// Redirected header option, Data holds the original packet
+type ICMPv6RedirectedHeaderOption struct {
+	Data []byte
+}
+
+func (o *ICMPv6RedirectedHeaderOption) Type() byte {
+	return ICMPv6OptionRedirectedHeader
+}
+
+func (o *ICMPv6RedirectedHeaderOption) Marshal() []byte {
+	// 6 byte reserved
+	return marshalOption(ICMPv6OptionRedirectedHeader, append(make([]byte, 6), o.Data...))
+}
+
+func (o *ICMPv6RedirectedHeaderOption) String() string {
+	return fmt.Sprintf("Redirected-Header: %d bytes", len(o.Data))
+}
+
+// MTU option
+type ICMPv6MTUOption struct {
+	MTU uint32
+}
+
+func (o *ICMPv6MTUOption) Type() byte {
+	return ICMPv6OptionMTU
+}
+
+func (o *ICMPv6MTUOption) Marshal() []byte {
+	b := make([]byte, 6)
+	binary.BigEndian.PutUint32(b[2:6], o.MTU)
+	return marshalOption(ICMPv6OptionMTU, b)
+}
+
+func (o *ICMPv6MTUOption) String() string {
+	return fmt.Sprintf("MTU: %d", o.MTU)
+}
+
+// Nonce option
+type ICMPv6NonceOption struct {
+	Nonce []byte
+}
+
+func (o *ICMPv6NonceOption) Type() byte {
+	return ICMPv6OptionNonce
+}
+
+func (o *ICMPv6NonceOption) Marshal() []byte {
+	return marshalOption(ICMPv6OptionNonce, o.Nonce)
+}
+
+func (o *ICMPv6NonceOption) String() string {
+	return fmt.Sprintf("Nonce: %x", o.Nonce)
+}
+
+// Route information option
+type ICMPv6RouteInformationOption struct {
+	PrefixLength uint8
+	Preference   uint8 // 2 bit router preference
+	Lifetime     uint32
+	Prefix       net.IP
+}
+
+func (o *ICMPv6RouteInformationOption) Type() byte {
+	return ICMPv6OptionRouteInformation
+}
+
+func (o *ICMPv6RouteInformationOption) Marshal() []byte {
+	b := make([]byte, 6)
+	b[0] = o.PrefixLength
+	b[1] = (o.Preference & 0x03) << 3
+	binary.BigEndian.PutUint32(b[2:6], o.Lifetime)
+	// only the octets covered by the prefix length, in units of 8 octets. A missing prefix is ::, the default
+	// route.
+	l := (int(o.PrefixLength) + 63) / 64 * 8
+	if l > net.IPv6len {
+		l = net.IPv6len
+	}
+	prefix := make([]byte, net.IPv6len)
+	copy(prefix, o.Prefix.To16())
+	b = append(b, prefix[:l]...)
+	return marshalOption(ICMPv6OptionRouteInformation, b)
+}
+
+func (o *ICMPv6RouteInformationOption) String() string {
+	return fmt.Sprintf("Route: %s/%d, Preference: %s, Lifetime: %d", o.Prefix, o.PrefixLength, RouterPreference(o.Preference), o.Lifetime)
+}
+
+// Name of a 2 bit router preference, RFC 4191 section 2.1
+func RouterPreference(prf uint8) string {
+	switch prf & 0x03 {
+	case 0:
+		return "medium"
+	case 1:
+		return "high"
+	case 3:
+		return "low"
+	}
+	return "reserved"
+}
+
+// Recursive DNS server option
+type ICMPv6RDNSSOption struct {
+	Lifetime uint32
+	Servers  []net.IP
+}
+
+func (o *ICMPv6RDNSSOption) Type() byte {
+	return ICMPv6OptionRDNSS
+}
+
+func (o *ICMPv6RDNSSOption) Marshal() []byte {
+	b := make([]byte, 6, 6+16*len(o.Servers))
+	binary.BigEndian.PutUint32(b[2:6], o.Lifetime)
+	for _, server := range o.Servers {
+		b = append(b, server.To16()...)
+	}
+	return marshalOption(ICMPv6OptionRDNSS, b)
+}
+
+func (o *ICMPv6RDNSSOption) String() string {
+	servers := make([]string, len(o.Servers))
+	for i, server := range o.Servers {
+		servers[i] = server.String()
+	}
+	return fmt.Sprintf("RDNSS: %s, Lifetime: %d", strings.Join(servers, " "), o.Lifetime)
+}
+
+// DNS search list option
+type ICMPv6DNSSLOption struct {
+	Lifetime uint32
+	Domains  []string
+}
+
+func (o *ICMPv6DNSSLOption) Type() byte {
+	return ICMPv6OptionDNSSL
+}
+
+func (o *ICMPv6DNSSLOption) Marshal() []byte {
+	b := make([]byte, 6)
+	binary.BigEndian.PutUint32(b[2:6], o.Lifetime)
+	// domain names in DNS wire format
+	for _, domain := range o.Domains {
+		for _, label := range strings.Split(strings.TrimSuffix(domain, "."), ".") {
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+		b = append(b, 0)
+	}
+	return marshalOption(ICMPv6OptionDNSSL, b)
+}
+
+func (o *ICMPv6DNSSLOption) String() string {
+	return fmt.Sprintf("DNSSL: %s, Lifetime: %d", strings.Join(o.Domains, " "), o.Lifetime)
+}
+
+// Option we don't know, kept as raw bytes
+type ICMPv6RawOption struct {
+	OptionType byte
+	Data       []byte
+}
+
+func (o *ICMPv6RawOption) Type() byte {
+	return o.OptionType
+}
+
+func (o *ICMPv6RawOption) Marshal() []byte {
+	return marshalOption(o.OptionType, o.Data)
+}
+
+func (o *ICMPv6RawOption) String() string {
+	return fmt.Sprintf("Option-Type: %d, Data: %x", o.OptionType, o.Data)
+}
+
+// Get the address of the first source or target link-layer address option, nil if there is none
+func findLinkAddress(opts []ICMPv6Option, t byte) net.HardwareAddr {
+	for _, o := range opts {
+		if lla, ok := o.(*ICMPv6LinkAddressOption); ok && lla.OptionType == t {
+			return lla.Addr
+		}
+	}
+	return nil
+}
+
+// Prepend type and length and pad data to a multiple of 8 octets
+func marshalOption(t byte, data []byte) []byte {
+	l := (len(data) + 2 + 7) / 8
+	b := make([]byte, l*8)
+	b[0] = t
+	b[1] = byte(l)
+	copy(b[2:], data)
+	return b
+}
+
+// Convert a list of options to a byte slice
+func ICMPv6MarshalOptions(opts []ICMPv6Option) []byte {
+	var buffer bytes.Buffer
+	for _, o := range opts {
+		buffer.Write(o.Marshal())
+	}
+	return buffer.Bytes()
+}
+
+// Walk the option list in units of 8 octets. Options with length zero are
+// rejected as required by RFC 4861 section 4.6.
+func ICMPv6ParseOptions(b []byte) ([]ICMPv6Option, error) {
+	opts := make([]ICMPv6Option, 0, 2)
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("Option is truncated")
+		}
+		l := int(b[1]) * 8
+		if l == 0 {
+			return nil, errors.New("Option has length zero")
+		}
+		if l > len(b) {
+			return nil, errors.New("Option exceeds message")
+		}
+		o, err := icmpv6ParseOption(b[0], b[2:l])
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, o)
+		b = b[l:]
+	}
+	return opts, nil
+}
+
+// Parse the option data (without type and length)
+func icmpv6ParseOption(t byte, data []byte) (ICMPv6Option, error) {
+	switch t {
+	case ICMPv6OptionSourceLinkAddress, ICMPv6OptionTargetLinkAddress:
+		// ethernet addresses fill exactly one unit, the padding of longer options is dropped
+		addr := data
+		if len(data) > 6 {
+			addr = data[:6]
+		}
+		return &ICMPv6LinkAddressOption{
+			OptionType: t,
+			Addr:       net.HardwareAddr(append([]byte(nil), addr...)),
+		}, nil
+	case ICMPv6OptionPrefixInformation:
+		if len(data) != 30 {
+			return nil, errors.New("Prefix information option has invalid length")
+		}
+		return &ICMPv6PrefixInformationOption{
+			PrefixLength:      data[0],
+			OnLink:            data[1]&0x80 != 0,
+			Autonomous:        data[1]&0x40 != 0,
+			ValidLifetime:     binary.BigEndian.Uint32(data[2:6]),
+			PreferredLifetime: binary.BigEndian.Uint32(data[6:10]),
+			Prefix:            net.IP(append([]byte(nil), data[14:30]...)),
+		}, nil
+	case ICMPv6OptionRedirectedHeader:
+		return &ICMPv6RedirectedHeaderOption{
+			Data: append([]byte(nil), data[6:]...),
+		}, nil
+	case ICMPv6OptionMTU:
+		if len(data) != 6 {
+			return nil, errors.New("MTU option has invalid length")
+		}
+		return &ICMPv6MTUOption{
+			MTU: binary.BigEndian.Uint32(data[2:6]),
+		}, nil
+	case ICMPv6OptionNonce:
+		return &ICMPv6NonceOption{
+			Nonce: append([]byte(nil), data...),
+		}, nil
+	case ICMPv6OptionRouteInformation:
+		// the prefix is 0, 8 or 16 octets long and has to cover the prefix length
+		if len(data) != 6 && len(data) != 14 && len(data) != 22 || data[0] > 128 || (int(data[0])+63)/64*8 > len(data)-6 {
+			return nil, errors.New("Route information option has invalid length")
+		}
+		o := &ICMPv6RouteInformationOption{
+			PrefixLength: data[0],
+			Preference:   (data[1] >> 3) & 0x03,
+			Lifetime:     binary.BigEndian.Uint32(data[2:6]),
+			Prefix:       make(net.IP, net.IPv6len),
+		}
+		copy(o.Prefix, data[6:])
+		return o, nil
+	case ICMPv6OptionRDNSS:
+		// at least one address
+		if len(data) < 22 || (len(data)-6)%16 != 0 {
+			return nil, errors.New("RDNSS option has invalid length")
+		}
+		o := &ICMPv6RDNSSOption{
+			Lifetime: binary.BigEndian.Uint32(data[2:6]),
+		}
+		for i := 6; i < len(data); i += 16 {
+			o.Servers = append(o.Servers, net.IP(append([]byte(nil), data[i:i+16]...)))
+		}
+		return o, nil
+	case ICMPv6OptionDNSSL:
+		if len(data) < 14 {
+			return nil, errors.New("DNSSL option has invalid length")
+		}
+		domains, err := parseDomainNames(data[6:])
+		if err != nil {
+			return nil, err
+		}
+		return &ICMPv6DNSSLOption{
+			Lifetime: binary.BigEndian.Uint32(data[2:6]),
+			Domains:  domains,
+		}, nil
+	}
+	return &ICMPv6RawOption{
+		OptionType: t,
+		Data:       append([]byte(nil), data...),
+	}, nil
+}
+
+// Parse uncompressed domain names in DNS wire format, trailing zero padding is skipped
+func parseDomainNames(b []byte) ([]string, error) {
+	var domains []string
+	var labels []string
+	for i := 0; i < len(b); {
+		l := int(b[i])
+		i++
+		if l == 0 {
+			// end of name, or padding
+			if len(labels) > 0 {
+				domains = append(domains, strings.Join(labels, "."))
+				labels = nil
+			}
+			continue
+		}
+		if l > 63 || i+l > len(b) {
+			return nil, errors.New("Domain name is invalid")
+		}
+		labels = append(labels, string(b[i:i+l]))
+		i += l
+	}
+	if len(labels) > 0 {
+		return nil, errors.New("Domain name is not terminated")
+	}
+	return domains, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	b := []byte{
+		// MTU 0:8
+		0x05, 0x01, 0x00, 0x00,
+		0x00, 0x00, 0x05, 0xdc,
+		// unknown option 8:16
+		0xfe, 0x01, 0x01, 0x02,
+		0x03, 0x04, 0x05, 0x06,
+		// target link-layer address 16:24
+		0x02, 0x01, 0x02, 0x00,
+		0x00, 0x00, 0x00, 0x01,
+		// prefix information 24:56
+		0x03, 0x04, 0x40, 0xc0,
+		0x00, 0x00, 0x0e, 0x10,
+		0x00, 0x00, 0x07, 0x08,
+		0x00, 0x00, 0x00, 0x00,
+		0x20, 0x01, 0x0d, 0xb8,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		// DNSSL 56:80
+		0x1f, 0x03, 0x00, 0x00,
+		0x00, 0x00, 0x0e, 0x10,
+		0x07, 'e', 'x', 'a',
+		'm', 'p', 'l', 'e',
+		0x03, 'c', 'o', 'm',
+		0x00, 0x00, 0x00, 0x00,
+	}
+	opts, err := ICMPv6ParseOptions(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(opts) != 5 {
+		t.Fatalf("Expected 5 options, got %d", len(opts))
+	}
+	if o, ok := opts[0].(*ICMPv6MTUOption); !ok || o.MTU != 1500 {
+		t.Error("Parsing MTU option failed")
+	}
+	if o, ok := opts[1].(*ICMPv6RawOption); !ok || o.OptionType != 0xfe || !bytes.Equal(o.Data, b[10:16]) {
+		t.Error("Unknown option was not kept")
+	}
+	if o, ok := opts[2].(*ICMPv6LinkAddressOption); !ok || o.Addr.String() != "02:00:00:00:00:01" {
+		t.Error("Parsing target link-layer address option failed")
+	}
+	if o, ok := opts[3].(*ICMPv6PrefixInformationOption); !ok || !o.OnLink || !o.Autonomous || o.PrefixLength != 64 || o.ValidLifetime != 3600 || !o.Prefix.Equal(net.ParseIP("2001:db8::")) {
+		t.Error("Parsing prefix information option failed")
+	}
+	if o, ok := opts[4].(*ICMPv6DNSSLOption); !ok || len(o.Domains) != 1 || o.Domains[0] != "example.com" {
+		t.Error("Parsing DNSSL option failed")
+	}
+	// marshaling has to result in the same bytes
+	if !bytes.Equal(ICMPv6MarshalOptions(opts), b) {
+		t.Error("Marshaled options differ")
+	}
+}
+
+func TestParseOptionsInvalid(t *testing.T) {
+	tests := map[string][]byte{
+		"zero length": {0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"truncated":   {0x01},
+		"too long":    {0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"bad prefix":  {0x03, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+		"bad route":   {0x18, 0x01, 0x30, 0x00, 0x00, 0x00, 0x00, 0x00},
+	}
+	for name, b := range tests {
+		if _, err := ICMPv6ParseOptions(b); err == nil {
+			t.Errorf("%s: options were accepted", name)
+		}
+	}
+}
+
+func TestRouteInformationOption(t *testing.T) {
+	b := []byte{
+		0x18, 0x02, 0x30, 0x08,
+		0x00, 0x00, 0x0e, 0x10,
+		0x20, 0x01, 0x0d, 0xb8,
+		0x00, 0x01, 0x00, 0x00,
+	}
+	opts, err := ICMPv6ParseOptions(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	o, ok := opts[0].(*ICMPv6RouteInformationOption)
+	if !ok || o.PrefixLength != 48 || RouterPreference(o.Preference) != "high" || o.Lifetime != 3600 || !o.Prefix.Equal(net.ParseIP("2001:db8:1::")) {
+		t.Fatal("Parsing route information option failed")
+	}
+	if !bytes.Equal(o.Marshal(), b) {
+		t.Error("Marshaled option differs")
+	}
+	// a default route without prefix
+	o = &ICMPv6RouteInformationOption{Lifetime: 60}
+	if len(o.Marshal()) != 8 {
+		t.Error("Marshaled default route has invalid length")
+	}
+	o.PrefixLength = 64
+	if d := o.Marshal(); len(d) != 16 || !bytes.Equal(d[8:], make([]byte, 8)) {
+		t.Error("Marshaled route without prefix differs")
+	}
+}
+
+func TestLinkAddressOptionPadding(t *testing.T) {
+	// ethernet address in an option of two units
+	b := []byte{0x01, 0x02, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 0}
+	opts, err := ICMPv6ParseOptions(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if mac := findLinkAddress(opts, ICMPv6OptionSourceLinkAddress); mac.String() != "02:00:00:00:00:01" {
+		t.Errorf("Link-layer address is %s", mac)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Addresses the responder answers for
+type proxyEntry struct {
+	Prefix *net.IPNet
+	Mac    net.HardwareAddr // nil for the interface MAC
+}
+
+// Read the proxied addresses, one per line: <address or prefix/length> [<mac>].
+// Empty lines and comments starting with # are skipped.
+func readProxies(name string) ([]*proxyEntry, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []*proxyEntry
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := scanner.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		e, err := parseProxy(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, line, err.Error())
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func parseProxy(fields []string) (*proxyEntry, error) {
+	if len(fields) > 2 {
+		return nil, fmt.Errorf("expected <address or prefix> [<mac>]")
+	}
+	e := &proxyEntry{}
+	if strings.Contains(fields[0], "/") {
+		_, prefix, err := net.ParseCIDR(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		e.Prefix = prefix
+	} else {
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			return nil, fmt.Errorf("%s is no valid IP address", fields[0])
+		}
+		e.Prefix = &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+	}
+	if e.Prefix.IP.To4() != nil || e.Prefix.IP.IsMulticast() {
+		return nil, fmt.Errorf("%s is no IPv6 unicast address", fields[0])
+	}
+	if len(fields) == 2 {
+		mac, err := net.ParseMAC(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		e.Mac = mac
+	}
+	return e, nil
+}
+
+// Whether the entry covers a single address only
+func (e *proxyEntry) Single() bool {
+	ones, _ := e.Prefix.Mask.Size()
+	return ones == 128
+}
+
+// Find the first entry that covers target, nil if we don't answer for it
+func matchProxy(entries []*proxyEntry, target net.IP) *proxyEntry {
+	for _, e := range entries {
+		if e.Prefix.Contains(target) {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMatchProxy(t *testing.T) {
+	var entries []*proxyEntry
+	for _, fields := range [][]string{
+		{"fd01::100"},
+		{"fd01:0:0:1::/64", "02:00:00:00:00:aa"},
+	} {
+		e, err := parseProxy(fields)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		entries = append(entries, e)
+	}
+	tests := map[string]string{
+		"fd01::100":     "",
+		"fd01::101":     "-",
+		"fd01:0:0:1::5": "02:00:00:00:00:aa",
+		"fd01:0:0:2::5": "-",
+	}
+	for target, mac := range tests {
+		e := matchProxy(entries, net.ParseIP(target))
+		if e == nil && mac != "-" || e != nil && e.Mac.String() != mac {
+			t.Errorf("%s matched %v", target, e)
+		}
+	}
+	if !entries[0].Single() || entries[1].Single() {
+		t.Error("Single address entries are not detected")
+	}
+	for _, fields := range [][]string{{"10.0.0.1"}, {"ff02::1"}, {"fd01::1", "nomac"}, {"fd01::/129"}} {
+		if _, err := parseProxy(fields); err == nil {
+			t.Errorf("%v was accepted", fields)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"grnvs/pcap"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Answer neighbor solicitations for the proxied addresses on iface, runs until it is killed
+func proxy(iface *net.Interface, entries []*proxyEntry, verbose bool) int {
+	socket, err := openPacketSocket(iface)
+	if err != nil {
+		panic(err)
+	}
+	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
+	defer f.Close()
+	// Solicitations go to the solicited-node group of the target, or to its MAC for unreachability detection
+	memberships := make(map[string]bool)
+	join := func(mrType uint16, mac net.HardwareAddr) {
+		key := fmt.Sprintf("%d %s", mrType, mac)
+		if memberships[key] {
+			return
+		}
+		memberships[key] = true
+		if err := addMembership(socket, iface, mrType, mac); err != nil {
+			panic(err)
+		}
+	}
+	for _, e := range entries {
+		if e.Single() {
+			join(syscall.PACKET_MR_MULTICAST, MulticastMac(SolicitedNodeAddress(e.Prefix.IP)))
+		} else {
+			join(syscall.PACKET_MR_ALLMULTI, nil)
+		}
+		if e.Mac != nil && !bytes.Equal(e.Mac, iface.HardwareAddr) {
+			join(syscall.PACKET_MR_PROMISC, nil)
+		}
+	}
+
+	readICMPv6(f, iface, verbose, []byte{0x87}, func(etherSrc net.HardwareAddr, header *IPv6Header, b []byte) {
+		ns, err := ICMPv6ValidateNeighborSolicitation(header, b)
+		if err != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped neighbor solicitation from %s: %s\n", header.Src, err.Error())
+			}
+			return
+		}
+		target := net.IP(ns.TargetAddress[:])
+		e := matchProxy(entries, target)
+		if e == nil {
+			return
+		}
+		mac := e.Mac
+		if mac == nil {
+			mac = iface.HardwareAddr
+		}
+		// RFC 4861 section 7.2.4, duplicate address detection is answered to all nodes and unsolicited
+		var dst net.IP
+		var dMac net.HardwareAddr
+		var flags uint8
+		if header.Src.IsUnspecified() {
+			dst = net.IPv6linklocalallnodes
+			dMac = MulticastMac(dst)
+		} else {
+			dst = header.Src
+			dMac = orMac(ns.SourceLinkAddress(), etherSrc)
+			flags = ICMPv6NeighborAdvertisementFlagS
+		}
+		data := buildAdvertisement(mac, target, dst, dMac, flags)
+		if _, err := syscall.Write(socket, data); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to send neighbor advertisement.\n%s\n", err.Error())
+			return
+		}
+		record(iface.Name, data, pcap.Outbound)
+		fmt.Printf("%s answered %s at %s to %s\n", time.Now().Format(time.RFC3339), target, mac, dst)
+	})
+	return exitResolved
+}
+
+// Build the ethernet frame of a neighbor advertisement for target at mac. The target is the source address,
+// the override flag is not set as recommended for proxies in RFC 4861 section 7.2.8.
+func buildAdvertisement(mac net.HardwareAddr, target, dst net.IP, dMac net.HardwareAddr, flags uint8) []byte {
+	eFrame := NewEthernetFrame(0x86DD, mac, dMac)
+	icmp := ICMPv6NeighborAdvertisement{
+		Header: ICMPv6MessageHeader{
+			Type: 0x88,
+			Code: 0x00,
+		},
+		Options: []ICMPv6Option{&ICMPv6LinkAddressOption{
+			OptionType: ICMPv6OptionTargetLinkAddress,
+			Addr:       mac,
+		}},
+	}
+	icmp.SetFlags(flags)
+	copy(icmp.TargetAddress[:], target)
+	ipHeader := IPv6Header{
+		Version:    0x6,
+		PayloadLen: len(icmp.Marshal()),
+		NextHeader: 0x3a,
+		HopLimit:   0xff,
+		Src:        target,
+		Dst:        dst,
+	}
+	icmp.Header.Checksum = ICMPv6Checksum(ipHeader, icmp.Marshal())
+	data := append(eFrame.Marshal(), ipHeader.Marshal()...)
+	return append(data, icmp.Marshal()...)
+}
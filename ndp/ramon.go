@@ -0,0 +1,51 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// Passively check every router advertisement on iface against the legitimate routers, runs until it is killed.
+// Alerts are printed and appended as JSON lines to alertFile.
+func ramon(iface *net.Interface, routers []*router, alertFile string, verbose bool) int {
+	var out *json.Encoder
+	if alertFile != "" {
+		f, err := os.OpenFile(alertFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to open %s.\n%s\n", alertFile, err.Error())
+			return exitNoAnswer
+		}
+		defer f.Close()
+		out = json.NewEncoder(f)
+	}
+	socket, err := openPacketSocket(iface)
+	if err != nil {
+		panic(err)
+	}
+	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
+	defer f.Close()
+
+	dataIn := make(chan *advertisement, 16)
+	go receiveAdvertisements(f, iface, verbose, dataIn)
+	monitor := newRAMonitor(iface.Name, routers)
+	for a := range dataIn {
+		if verbose {
+			a.Print()
+		}
+		for _, alert := range monitor.Check(a.Src, a.Mac(), a.RA, time.Now()) {
+			fmt.Printf("%s %s\n", alert.Time.Format(time.RFC3339), alert.Text)
+			if out == nil {
+				continue
+			}
+			if err := out.Encode(alert); err != nil {
+				fmt.Fprintf(os.Stderr, "Unable to write alert.\n%s\n", err.Error())
+			}
+		}
+	}
+	return exitResolved
+}
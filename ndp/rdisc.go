@@ -0,0 +1,154 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"grnvs/pcap"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// A valid router advertisement together with its sender
+type advertisement struct {
+	RA       *ICMPv6RouterAdvertisement
+	Src      net.IP
+	EtherSrc net.HardwareAddr
+}
+
+// The link-layer address of the router, from the option or the ethernet source
+func (a *advertisement) Mac() net.HardwareAddr {
+	if mac := a.RA.SourceLinkAddress(); mac != nil {
+		return mac
+	}
+	return a.EtherSrc
+}
+
+// Print the router and every option of the advertisement
+func (a *advertisement) Print() {
+	mac := a.Mac()
+	fmt.Printf("Router advertisement from %s at %s\n", a.Src, mac)
+	fmt.Printf("  %s\n", a.RA)
+	for _, o := range a.RA.Options {
+		fmt.Printf("  %s\n", o)
+	}
+}
+
+// Send tries router solicitations to ff02::2 spaced by retransTimer and print every router advertisement received
+// until timeout. Returns exitResolved if there was at least one advertisement.
+func rdisc(iface *net.Interface, timeout time.Duration, tries int, retransTimer time.Duration, dryRun, verbose bool) int {
+	// Create icmp payload
+	rs := ICMPv6RouterSolicitation{
+		Header: ICMPv6MessageHeader{
+			Type: 0x85,
+			Code: 0x00,
+		},
+	}
+	// Solicitations are sent from a link-local address, or from :: without source link-layer address
+	sAddr := getLinkLocalAddr(iface)
+	if sAddr == nil {
+		sAddr = net.IPv6unspecified
+	} else {
+		rs.Options = append(rs.Options, &ICMPv6LinkAddressOption{
+			OptionType: ICMPv6OptionSourceLinkAddress,
+			Addr:       iface.HardwareAddr,
+		})
+	}
+	// All-routers multicast address
+	dAddr := net.ParseIP("ff02::2")
+	eFrame := NewEthernetFrame(0x86DD, iface.HardwareAddr, MulticastMac(dAddr))
+	ipHeader := IPv6Header{
+		Version:    0x6,
+		PayloadLen: len(rs.Marshal()),
+		NextHeader: 0x3a,
+		HopLimit:   0xff,
+		Src:        sAddr,
+		Dst:        dAddr,
+	}
+	rs.Header.Checksum = ICMPv6Checksum(ipHeader, rs.Marshal())
+	data := append(eFrame.Marshal(), ipHeader.Marshal()...)
+	data = append(data, rs.Marshal()...)
+	// Only record the frame
+	if dryRun {
+		record(iface.Name, data, pcap.Outbound)
+		return exitResolved
+	}
+
+	socket, err := openPacketSocket(iface)
+	if err != nil {
+		panic(err)
+	}
+	send := func() {
+		_, err := syscall.Write(socket, data)
+		if err != nil {
+			panic(err)
+		}
+		record(iface.Name, data, pcap.Outbound)
+	}
+	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
+	defer f.Close()
+
+	// Advertisements are sent to ff02::1 or to us
+	dataIn := make(chan *advertisement, 1)
+	go receiveAdvertisements(f, iface, verbose, dataIn)
+
+	send()
+	retransmit := time.NewTicker(retransTimer)
+	defer retransmit.Stop()
+	sent := 1
+	timedout := time.After(timeout)
+	received := 0
+	for {
+		select {
+		case a := <-dataIn:
+			a.Print()
+			received++
+		case <-retransmit.C:
+			if sent < tries {
+				send()
+				sent++
+			}
+		case <-timedout:
+			if received == 0 {
+				fmt.Println("No router advertisement received")
+				return exitNoAnswer
+			}
+			return exitResolved
+		}
+	}
+}
+
+// Pass every valid router advertisement read from f to dataIn
+func receiveAdvertisements(f *os.File, iface *net.Interface, verbose bool, dataIn chan<- *advertisement) {
+	readICMPv6(f, iface, verbose, []byte{0x86}, func(etherSrc net.HardwareAddr, header *IPv6Header, b []byte) {
+		ra, err := ICMPv6ValidateRouterAdvertisement(header, b)
+		if err != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped router advertisement from %s: %s\n", header.Src, err.Error())
+			}
+			return
+		}
+		dataIn <- &advertisement{
+			RA:       ra,
+			Src:      header.Src,
+			EtherSrc: etherSrc,
+		}
+	})
+}
+
+// Get a link-local address of the interface, nil if it has none
+func getLinkLocalAddr(iface *net.Interface) net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		panic(err)
+	}
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err == nil && ip.To4() == nil && ip.IsLinkLocalUnicast() {
+			return ip
+		}
+	}
+	return nil
+}
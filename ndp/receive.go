@@ -0,0 +1,92 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"grnvs/pcap"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Create a raw socket bound to iface, sudo required see man 7 raw
+func openPacketSocket(iface *net.Interface) (int, error) {
+	socket, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(syscall.ETH_P_ALL)))
+	if err != nil {
+		return -1, err
+	}
+	err = syscall.Bind(socket, &syscall.SockaddrLinklayer{
+		Protocol: htons(syscall.ETH_P_ALL),
+		Ifindex:  iface.Index,
+	})
+	if err != nil {
+		syscall.Close(socket)
+		return -1, err
+	}
+	return socket, nil
+}
+
+// struct packet_mreq, see man 7 packet
+type packetMreq struct {
+	Ifindex int32
+	Type    uint16
+	Alen    uint16
+	Address [8]byte
+}
+
+// Receive more frames on iface: PACKET_MR_MULTICAST for the multicast mac address, PACKET_MR_ALLMULTI or
+// PACKET_MR_PROMISC with mac nil
+func addMembership(socket int, iface *net.Interface, mrType uint16, mac net.HardwareAddr) error {
+	mreq := packetMreq{
+		Ifindex: int32(iface.Index),
+		Type:    mrType,
+		Alen:    uint16(len(mac)),
+	}
+	copy(mreq.Address[:], mac)
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(socket), syscall.SOL_PACKET, syscall.PACKET_ADD_MEMBERSHIP, uintptr(unsafe.Pointer(&mreq)), unsafe.Sizeof(mreq), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Read frames from f forever and call handle for every ICMPv6 message of one of the types. The message ends
+// with the ip payload, ethernet padding is cut off. Our own frames are skipped, the others are recorded.
+func readICMPv6(f *os.File, iface *net.Interface, verbose bool, types []byte, handle func(etherSrc net.HardwareAddr, header *IPv6Header, b []byte)) {
+	for {
+		// a full frame of the link, router advertisements with many options fill it
+		b := make([]byte, iface.MTU+EthernetFrameLen)
+		numRead, err := f.Read(b)
+		if err != nil {
+			panic(err)
+		}
+		if numRead < EthernetFrameLen {
+			continue
+		}
+		eFrame, err := EthernetFrameParse(b[:EthernetFrameLen])
+		if err != nil || eFrame.Ethertype != 0x86DD || bytes.Equal(eFrame.SrcMac[:], iface.HardwareAddr) {
+			continue
+		}
+		offset := binary.Size(eFrame)
+		header, err := IPv6ParseHeader(b[offset:numRead])
+		if err != nil || header.NextHeader != 0x3a {
+			continue
+		}
+		offset += IPv6HeaderLen
+		if offset >= numRead || bytes.IndexByte(types, b[offset]) < 0 {
+			continue
+		}
+		record(iface.Name, b[:numRead], pcap.Inbound)
+		if offset+header.PayloadLen > numRead {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped ICMPv6 type %d from %s: message is truncated\n", b[offset], header.Src)
+			}
+			continue
+		}
+		handle(net.HardwareAddr(append([]byte(nil), eFrame.SrcMac[:]...)), header, b[offset:offset+header.PayloadLen])
+	}
+}
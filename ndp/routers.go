@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A legitimate router from the -ramon file
+type router struct {
+	Mac       net.HardwareAddr
+	LinkLocal net.IP
+	Prefixes  []*net.IPNet // expected prefixes, empty to accept any
+}
+
+// Read the legitimate routers, one per line: router <mac> <link-local address> [<prefix>/<length>...]
+// Empty lines and comments starting with # are skipped.
+func readRouters(name string) ([]*router, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var routers []*router
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := scanner.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		r, err := parseRouter(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, line, err.Error())
+		}
+		routers = append(routers, r)
+	}
+	return routers, scanner.Err()
+}
+
+func parseRouter(fields []string) (*router, error) {
+	if fields[0] != "router" || len(fields) < 3 {
+		return nil, fmt.Errorf("expected router <mac> <link-local address> [<prefix>...]")
+	}
+	mac, err := net.ParseMAC(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	r := &router{
+		Mac:       mac,
+		LinkLocal: net.ParseIP(fields[2]),
+	}
+	if r.LinkLocal == nil || !r.LinkLocal.IsLinkLocalUnicast() {
+		return nil, fmt.Errorf("%s is no link-local address", fields[2])
+	}
+	for _, field := range fields[3:] {
+		_, prefix, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, err
+		}
+		r.Prefixes = append(r.Prefixes, prefix)
+	}
+	return r, nil
+}
+
+// Whether the router expects prefix to be advertised
+func (r *router) Expects(prefix *net.IPNet) bool {
+	if len(r.Prefixes) == 0 {
+		return true
+	}
+	for _, p := range r.Prefixes {
+		if p.String() == prefix.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// Alert about a router advertisement, the text field makes it usable as webhook payload
+type alert struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Interface string    `json:"interface"`
+	Router    string    `json:"router"`
+	Mac       string    `json:"mac"`
+	Text      string    `json:"text"`
+}
+
+// Routers send unsolicited advertisements at least every MaxRtrAdvInterval, at most 1800 s (RFC 4861 6.2.1). A
+// router that was quiet for that long and for its advertised router lifetime is forgotten.
+const raForgetAfter = 1800 * time.Second
+
+// Upper bound of remembered routers, a flood of advertisements from random addresses must not exhaust memory
+const raMaxSeen = 1024
+
+// What a router advertised last
+type routerState struct {
+	prefixes     string
+	lifetimeZero bool
+	expires      time.Time
+}
+
+// Compares router advertisements with the legitimate routers. Every condition is only reported when it
+// starts, not for every advertisement. A router that is forgotten after going quiet counts as new again.
+type raMonitor struct {
+	iface   string
+	routers []*router
+	seen    map[string]*routerState
+}
+
+func newRAMonitor(iface string, routers []*router) *raMonitor {
+	return &raMonitor{
+		iface:   iface,
+		routers: routers,
+		seen:    make(map[string]*routerState),
+	}
+}
+
+// Find the legitimate router with mac and link-local address, nil if it is unknown
+func (m *raMonitor) lookup(src net.IP, mac net.HardwareAddr) *router {
+	for _, r := range m.routers {
+		if bytes.Equal(r.Mac, mac) && r.LinkLocal.Equal(src) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Forget the routers whose state expired by now. If there are still too many, the one expiring first is dropped
+// to make room for another router.
+func (m *raMonitor) expire(now time.Time, room bool) {
+	oldest := ""
+	for key, state := range m.seen {
+		if !state.expires.After(now) {
+			delete(m.seen, key)
+		} else if oldest == "" || state.expires.Before(m.seen[oldest].expires) {
+			oldest = key
+		}
+	}
+	if room && len(m.seen) >= raMaxSeen {
+		delete(m.seen, oldest)
+	}
+}
+
+// Check an advertisement from src at mac and return the alerts it causes
+func (m *raMonitor) Check(src net.IP, mac net.HardwareAddr, ra *ICMPv6RouterAdvertisement, now time.Time) []*alert {
+	var alerts []*alert
+	report := func(event, format string, a ...interface{}) {
+		alerts = append(alerts, &alert{
+			Time:      now,
+			Event:     event,
+			Interface: m.iface,
+			Router:    src.String(),
+			Mac:       mac.String(),
+			Text:      fmt.Sprintf("%s: router %s at %s ", event, src, mac) + fmt.Sprintf(format, a...),
+		})
+	}
+	// advertised prefixes in a stable order
+	var prefixes []*net.IPNet
+	var names []string
+	for _, o := range ra.Options {
+		if pi, ok := o.(*ICMPv6PrefixInformationOption); ok {
+			prefix := &net.IPNet{
+				IP:   pi.Prefix.Mask(net.CIDRMask(int(pi.PrefixLength), 128)),
+				Mask: net.CIDRMask(int(pi.PrefixLength), 128),
+			}
+			prefixes = append(prefixes, prefix)
+			names = append(names, prefix.String())
+		}
+	}
+	sort.Strings(names)
+	current := &routerState{
+		prefixes:     strings.Join(names, " "),
+		lifetimeZero: ra.RouterLifetime == 0,
+		expires:      now.Add(raForgetAfter),
+	}
+	if lifetime := time.Duration(ra.RouterLifetime) * time.Second; lifetime > raForgetAfter {
+		current.expires = now.Add(lifetime)
+	}
+	key := mac.String() + " " + src.String()
+	_, known := m.seen[key]
+	m.expire(now, !known)
+	last, seen := m.seen[key]
+	m.seen[key] = current
+
+	r := m.lookup(src, mac)
+	if r == nil {
+		if !seen {
+			report("unknown-router", "is not a legitimate router, lifetime %ds, prefixes [%s]", ra.RouterLifetime, current.prefixes)
+		}
+	} else if !seen || last.prefixes != current.prefixes {
+		for _, prefix := range prefixes {
+			if !r.Expects(prefix) {
+				report("unexpected-prefix", "advertises %s", prefix)
+			}
+		}
+	}
+	if seen && last.prefixes != current.prefixes {
+		report("prefix-changed", "changed prefixes from [%s] to [%s]", last.prefixes, current.prefixes)
+	}
+	if current.lifetimeZero && (!seen || !last.lifetimeZero) {
+		report("lifetime-zero", "advertises router lifetime 0")
+	}
+	return alerts
+}
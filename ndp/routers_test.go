@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRAMonitor(t *testing.T) {
+	r, err := parseRouter([]string{"router", "02:00:00:00:00:01", "fe80::1", "2001:db8:1::/64"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	m := newRAMonitor("eth0", []*router{r})
+	ra := func(lifetime uint16, prefix string) *ICMPv6RouterAdvertisement {
+		return &ICMPv6RouterAdvertisement{
+			RouterLifetime: lifetime,
+			Options: []ICMPv6Option{&ICMPv6PrefixInformationOption{
+				PrefixLength: 64,
+				Prefix:       net.ParseIP(prefix),
+			}},
+		}
+	}
+	events := func(alerts []*alert) string {
+		s := ""
+		for _, a := range alerts {
+			s += a.Event + " "
+		}
+		return s
+	}
+	rogue, _ := net.ParseMAC("02:00:00:00:00:02")
+	tests := []struct {
+		src      string
+		mac      net.HardwareAddr
+		ra       *ICMPv6RouterAdvertisement
+		expected string
+	}{
+		{"fe80::1", r.Mac, ra(1800, "2001:db8:1::"), ""},
+		{"fe80::1", r.Mac, ra(1800, "2001:db8:1::"), ""},
+		{"fe80::2", rogue, ra(1800, "2001:db8:1::"), "unknown-router "},
+		{"fe80::2", rogue, ra(1800, "2001:db8:1::"), ""},
+		{"fe80::1", r.Mac, ra(1800, "2001:db8:2::"), "unexpected-prefix prefix-changed "},
+		{"fe80::1", r.Mac, ra(0, "2001:db8:2::"), "lifetime-zero "},
+		{"fe80::1", r.Mac, ra(0, "2001:db8:2::"), ""},
+	}
+	for i, test := range tests {
+		if s := events(m.Check(net.ParseIP(test.src), test.mac, test.ra, time.Now())); s != test.expected {
+			t.Errorf("%d: expected alerts %q, got %q", i, test.expected, s)
+		}
+	}
+}
+
+func TestParseRouterInvalid(t *testing.T) {
+	for _, fields := range [][]string{
+		{"router", "02:00:00:00:00:01"},
+		{"router", "02:00:00:00:00:01", "2001:db8::1"},
+		{"router", "02:00:00:00:00:01", "fe80::1", "2001:db8::"},
+		{"host", "02:00:00:00:00:01", "fe80::1"},
+	} {
+		if _, err := parseRouter(fields); err == nil {
+			t.Errorf("%v was accepted", fields)
+		}
+	}
+}
+
+func TestRAMonitorExpire(t *testing.T) {
+	m := newRAMonitor("eth0", nil)
+	ra := func(lifetime uint16) *ICMPv6RouterAdvertisement {
+		return &ICMPv6RouterAdvertisement{RouterLifetime: lifetime}
+	}
+	rogue, _ := net.ParseMAC("02:00:00:00:00:02")
+	src := net.ParseIP("fe80::2")
+	now := time.Now()
+	if len(m.Check(src, rogue, ra(9000), now)) != 1 {
+		t.Error("Unknown router was not reported")
+	}
+	// the advertised lifetime outlasts the minimum
+	if len(m.Check(src, rogue, ra(0), now.Add(2*time.Hour))) != 1 {
+		t.Error("Lifetime 0 was not reported")
+	}
+	if len(m.Check(src, rogue, ra(0), now.Add(2*time.Hour+raForgetAfter-time.Second))) != 0 {
+		t.Error("Router was forgotten too early")
+	}
+	if len(m.Check(src, rogue, ra(0), now.Add(3*time.Hour+raForgetAfter))) != 2 {
+		t.Error("Router was not forgotten")
+	}
+	// random sources are capped
+	for i := 0; i < 2*raMaxSeen; i++ {
+		mac := net.HardwareAddr{0x02, 0, 0, 0, byte(i >> 8), byte(i)}
+		m.Check(src, mac, ra(1800), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if len(m.seen) != raMaxSeen {
+		t.Errorf("%d routers remembered", len(m.seen))
+	}
+}
@@ -0,0 +1,251 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"grnvs/pcap"
+	"net"
+	"os"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// A sweep target and what was learned about it
+type lookup struct {
+	IP       net.IP
+	Mac      net.HardwareAddr // nil while unanswered
+	IsRouter bool
+	RTT      time.Duration // since the last solicitation before the answer
+	sent     int
+	lastSent time.Time
+}
+
+// Upper bound of -rate. The interval between solicitations must stay well above a nanosecond, and no link
+// answers faster anyway.
+const maxRate = 100000
+
+// A lookup that is due for retransmission or to be given up
+type retransmission struct {
+	l   *lookup
+	due time.Time
+}
+
+// Resolve all targets with neighbor solicitations. At most rate solicitations are sent per second, new targets
+// are solicited while earlier ones wait for their answer. Every target is solicited up to tries times spaced by
+// retransTimer. A single receive loop matches the advertisements to the outstanding lookups. Prints a table of
+// the answered targets and returns exitNoAnswer if none answered.
+func sweep(iface *net.Interface, src net.IP, targets []net.IP, rate, tries int, retransTimer time.Duration, dryRun, verbose bool) int {
+	lookups := make([]*lookup, len(targets))
+	for i, ip := range targets {
+		lookups[i] = &lookup{IP: ip}
+	}
+	solicitation := func(l *lookup) []byte {
+		dst := SolicitedNodeAddress(l.IP)
+		return buildSolicitation(iface, src, dst, MulticastMac(dst), l.IP)
+	}
+	// Only record the frames
+	if dryRun {
+		for _, l := range lookups {
+			record(iface.Name, solicitation(l), pcap.Outbound)
+		}
+		return exitResolved
+	}
+
+	socket, err := openPacketSocket(iface)
+	if err != nil {
+		panic(err)
+	}
+	f := os.NewFile(uintptr(socket), fmt.Sprintf("fd %d", socket))
+	defer f.Close()
+	dataIn := make(chan *answer, 16)
+	go receiveSweepAnswers(f, iface, verbose, dataIn)
+
+	// Outstanding lookups by target, retransmissions in the order they are due
+	outstanding := make(map[string]*lookup)
+	var queue []*retransmission
+	send := func(l *lookup) {
+		data := solicitation(l)
+		l.lastSent = time.Now()
+		l.sent++
+		if _, err := syscall.Write(socket, data); err != nil {
+			panic(err)
+		}
+		record(iface.Name, data, pcap.Outbound)
+		outstanding[l.IP.String()] = l
+		queue = append(queue, &retransmission{l: l, due: l.lastSent.Add(retransTimer)})
+	}
+
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+	next := 0
+	for next < len(lookups) || len(outstanding) > 0 {
+		select {
+		case a := <-dataIn:
+			l, ok := outstanding[net.IP(a.NA.TargetAddress[:]).String()]
+			if !ok {
+				continue
+			}
+			l.Mac, _ = a.Mac()
+			l.IsRouter = a.NA.FlagSet(ICMPv6NeighborAdvertisementFlagR)
+			l.RTT = a.Time.Sub(l.lastSent)
+			delete(outstanding, l.IP.String())
+		case now := <-ticker.C:
+			// Retransmissions use the tick first, the last solicitation of a target is given one more
+			// retransTimer to be answered
+			sent := false
+			for !sent && len(queue) > 0 && !now.Before(queue[0].due) {
+				l := queue[0].l
+				queue = queue[1:]
+				if _, ok := outstanding[l.IP.String()]; !ok {
+					continue
+				}
+				if l.sent < tries {
+					send(l)
+					sent = true
+				} else {
+					delete(outstanding, l.IP.String())
+				}
+			}
+			if !sent && next < len(lookups) {
+				send(lookups[next])
+				next++
+			}
+		}
+	}
+	return printSweep(lookups)
+}
+
+// Print the answered lookups in the order of the targets
+func printSweep(lookups []*lookup) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tMAC\tROUTER\tRTT")
+	answered := 0
+	for _, l := range lookups {
+		if l.Mac == nil {
+			continue
+		}
+		answered++
+		fmt.Fprintf(w, "%s\t%s\t%t\t%.3f ms\n", l.IP, l.Mac, l.IsRouter, float64(l.RTT)/float64(time.Millisecond))
+	}
+	w.Flush()
+	fmt.Printf("%d of %d addresses answered\n", answered, len(lookups))
+	if answered == 0 {
+		return exitNoAnswer
+	}
+	return exitResolved
+}
+
+// Pass every valid neighbor advertisement read from f to dataIn, the sweep matches them to its lookups
+func receiveSweepAnswers(f *os.File, iface *net.Interface, verbose bool, dataIn chan<- *answer) {
+	readICMPv6(f, iface, verbose, []byte{0x88}, func(etherSrc net.HardwareAddr, header *IPv6Header, b []byte) {
+		received := time.Now()
+		na, err := ICMPv6ValidateNeighborAdvertisement(header, b)
+		if err == nil && na.TargetLinkAddress() == nil && !na.FlagSet(ICMPv6NeighborAdvertisementFlagS) {
+			err = fmt.Errorf("unsolicited and no target link-layer address option")
+		}
+		if err != nil {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Dropped neighbor advertisement from %s: %s\n", header.Src, err.Error())
+			}
+			return
+		}
+		dataIn <- &answer{
+			NA:       na,
+			EtherSrc: etherSrc,
+			Time:     received,
+		}
+	})
+}
+
+// Collect the sweep targets from the arguments and the -from, -low, -eui64 and -seen sources, without repetitions
+func sweepTargets(iface *net.Interface, args []string, from, low, eui64, macs, seen string) ([]net.IP, error) {
+	var targets []net.IP
+	for _, arg := range args {
+		ip, err := parseIPv6(arg)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, ip)
+	}
+	if from != "" {
+		ips, err := readAddresses(from)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, ips...)
+	}
+	if low != "" {
+		_, prefix, err := net.ParseCIDR(low)
+		if err != nil {
+			return nil, err
+		}
+		if ones, bits := prefix.Mask.Size(); bits != 8*net.IPv6len || ones > 120 {
+			return nil, fmt.Errorf("%s is no IPv6 prefix of at most 120 bits", low)
+		}
+		targets = append(targets, lowByteAddresses(prefix)...)
+	}
+	if eui64 != "" {
+		_, prefix, err := net.ParseCIDR(eui64)
+		if err != nil {
+			return nil, err
+		}
+		if ones, bits := prefix.Mask.Size(); bits != 8*net.IPv6len || ones != 64 {
+			return nil, fmt.Errorf("%s is no /64 IPv6 prefix", eui64)
+		}
+		known, err := readMacs(macs)
+		if err != nil {
+			return nil, err
+		}
+		for _, mac := range known {
+			targets = append(targets, eui64Address(prefix, mac))
+		}
+	}
+	if seen != "" {
+		f, err := os.Open(seen)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := seenAddresses(f, getOnLinkPrefixes(iface))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		// our own addresses are in the capture too
+		own, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+	seen:
+		for _, ip := range ips {
+			for _, addr := range own {
+				if a, _, err := net.ParseCIDR(addr.String()); err == nil && a.Equal(ip) {
+					continue seen
+				}
+			}
+			targets = append(targets, ip)
+		}
+	}
+	targets = uniqueAddresses(targets)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets")
+	}
+	return targets, nil
+}
+
+// The on-link prefixes of the interface, addresses seen in a capture are only swept within them
+func getOnLinkPrefixes(iface *net.Interface) []*net.IPNet {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		panic(err)
+	}
+	var prefixes []*net.IPNet
+	for _, addr := range addrs {
+		_, prefix, err := net.ParseCIDR(addr.String())
+		if err == nil && prefix.IP.To4() == nil && !prefix.IP.IsLinkLocalUnicast() {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
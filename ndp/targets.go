@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"grnvs/pcap"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// Read one IPv6 address per line, or for -macs one MAC address per line. Only the first field counts, so
+// /etc/ethers style files can be used. Empty lines and comments starting with # are skipped.
+func readFields(name string, parse func(string) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := scanner.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := parse(fields[0]); err != nil {
+			return fmt.Errorf("%s:%d: %s", name, line, err.Error())
+		}
+	}
+	return scanner.Err()
+}
+
+func readAddresses(name string) ([]net.IP, error) {
+	var ips []net.IP
+	err := readFields(name, func(s string) error {
+		ip, err := parseIPv6(s)
+		ips = append(ips, ip)
+		return err
+	})
+	return ips, err
+}
+
+func readMacs(name string) ([]net.HardwareAddr, error) {
+	var macs []net.HardwareAddr
+	err := readFields(name, func(s string) error {
+		mac, err := net.ParseMAC(s)
+		if err == nil && len(mac) != 6 {
+			err = fmt.Errorf("%s is no 48 bit MAC address", s)
+		}
+		macs = append(macs, mac)
+		return err
+	})
+	return macs, err
+}
+
+func parseIPv6(s string) (net.IP, error) {
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() != nil {
+		return nil, fmt.Errorf("%s is no valid IPv6 address", s)
+	}
+	return ip, nil
+}
+
+// The addresses <prefix>::1 to <prefix>::ff, commonly used for routers and servers
+func lowByteAddresses(prefix *net.IPNet) []net.IP {
+	ips := make([]net.IP, 0, 255)
+	for i := 1; i <= 0xff; i++ {
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, prefix.IP.Mask(prefix.Mask))
+		ip[15] |= byte(i)
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// The address a host with mac configures in the /64 prefix by SLAAC with a modified EUI-64 interface
+// identifier, RFC 4291 appendix A
+func eui64Address(prefix *net.IPNet, mac net.HardwareAddr) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP.Mask(prefix.Mask))
+	copy(ip[8:11], mac[0:3])
+	ip[8] ^= 0x02
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	copy(ip[13:16], mac[3:6])
+	return ip
+}
+
+// Collect the unicast source and destination addresses of the IPv6 packets in a capture that are link-local
+// or in one of the on-link prefixes. Ethernet frames and raw packets are evaluated.
+func seenAddresses(r io.Reader, onLink []*net.IPNet) ([]net.IP, error) {
+	pr, err := pcap.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for {
+		p, err := pr.ReadPacket()
+		if err == io.EOF {
+			return ips, nil
+		} else if err != nil {
+			return ips, err
+		}
+		b := p.Data
+		switch p.LinkType {
+		case pcap.LinkTypeEthernet:
+			if len(b) < EthernetFrameLen || binary.BigEndian.Uint16(b[12:14]) != 0x86DD {
+				continue
+			}
+			b = b[EthernetFrameLen:]
+		case pcap.LinkTypeRaw:
+		default:
+			continue
+		}
+		header, err := IPv6ParseHeader(b)
+		if err != nil {
+			continue
+		}
+		for _, ip := range []net.IP{header.Src, header.Dst} {
+			if isNeighbor(ip, onLink) {
+				ips = append(ips, ip)
+			}
+		}
+	}
+}
+
+// Whether ip may be the address of a neighbor
+func isNeighbor(ip net.IP, onLink []*net.IPNet) bool {
+	if ip.To4() != nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsMulticast() {
+		return false
+	}
+	if ip.IsLinkLocalUnicast() {
+		return true
+	}
+	for _, prefix := range onLink {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove repeated addresses, the first occurrence is kept
+func uniqueAddresses(ips []net.IP) []net.IP {
+	seen := make(map[string]bool)
+	unique := ips[:0]
+	for _, ip := range ips {
+		if !seen[ip.String()] {
+			seen[ip.String()] = true
+			unique = append(unique, ip)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"grnvs/pcap"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCandidates(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("fd01::/64")
+	low := lowByteAddresses(prefix)
+	if len(low) != 255 || low[0].String() != "fd01::1" || low[254].String() != "fd01::ff" {
+		t.Errorf("Low byte addresses are %s to %s", low[0], low[len(low)-1])
+	}
+	mac, _ := net.ParseMAC("fe:fd:4e:8d:e7:06")
+	if ip := eui64Address(prefix, mac); ip.String() != "fd01::fcfd:4eff:fe8d:e706" {
+		t.Errorf("EUI-64 address is %s", ip)
+	}
+	unique := uniqueAddresses([]net.IP{net.ParseIP("fd01::1"), net.ParseIP("fd01::2"), net.ParseIP("fd01:0::1")})
+	if len(unique) != 2 || unique[1].String() != "fd01::2" {
+		t.Errorf("Unique addresses are %v", unique)
+	}
+}
+
+func TestSeenAddresses(t *testing.T) {
+	var buffer bytes.Buffer
+	w, err := pcap.NewWriter(&buffer)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	packet := func(src, dst string) []byte {
+		h := IPv6Header{Version: 6, NextHeader: 0x3a, HopLimit: 255, Src: net.ParseIP(src), Dst: net.ParseIP(dst)}
+		return h.Marshal()
+	}
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	eFrame := NewEthernetFrame(0x86DD, mac, MulticastMac(net.ParseIP("ff02::1")))
+	w.WritePacket(pcap.LinkTypeEthernet, "eth0", time.Now(), append(eFrame.Marshal(), packet("fe80::1", "ff02::1")...), pcap.Inbound)
+	w.WritePacket(pcap.LinkTypeRaw, "eth0", time.Now(), packet("fd01::2", "2001:db8::1"), pcap.Inbound)
+	eFrame.Ethertype = 0x0800
+	w.WritePacket(pcap.LinkTypeEthernet, "eth0", time.Now(), append(eFrame.Marshal(), packet("fd01::3", "fd01::4")...), pcap.Inbound)
+	_, onLink, _ := net.ParseCIDR("fd01::/64")
+	ips, err := seenAddresses(&buffer, []*net.IPNet{onLink})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(ips) != 2 || ips[0].String() != "fe80::1" || ips[1].String() != "fd01::2" {
+		t.Errorf("Seen addresses are %v", ips)
+	}
+}
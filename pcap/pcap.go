@@ -0,0 +1,121 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+// Link types, see http://www.tcpdump.org/linktypes.html
+const (
+	LinkTypeEthernet = 1   // frames with ethernet header
+	LinkTypeRaw      = 101 // raw IPv4 or IPv6 packets
+)
+
+// pcapng block types, see https://github.com/pcapng/pcapng
+const (
+	blockSectionHeader  = 0x0A0D0D0A
+	blockInterface      = 0x00000001
+	blockEnhancedPacket = 0x00000006
+	byteOrderMagic      = 0x1A2B3C4D
+	optionEnd           = 0
+	optionInterfaceName = 2
+	optionPacketFlags   = 2
+	defaultSnapLen      = 65535
+)
+
+// Direction of a recorded packet
+type Direction uint32
+
+const (
+	Inbound  Direction = 1
+	Outbound Direction = 2
+)
+
+// Writes packets in pcapng format. A file can hold packets of several
+// interfaces with different link types, so ethernet frames and raw IP
+// packets can be recorded side by side.
+type Writer struct {
+	mu         sync.Mutex
+	w          io.Writer
+	interfaces map[string]uint32
+}
+
+// Constructor, writes the section header
+func NewWriter(w io.Writer) (*Writer, error) {
+	pw := &Writer{
+		w:          w,
+		interfaces: make(map[string]uint32),
+	}
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(byteOrderMagic))
+	// version 1.0
+	binary.Write(&body, binary.LittleEndian, []uint16{1, 0})
+	// unknown section length
+	binary.Write(&body, binary.LittleEndian, int64(-1))
+	return pw, pw.writeBlock(blockSectionHeader, body.Bytes())
+}
+
+// Record data captured at t on the interface name. The interface is described
+// in the file the first time it is used.
+func (w *Writer) WritePacket(linkType uint16, name string, t time.Time, data []byte, dir Direction) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id, err := w.interfaceID(linkType, name)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	// timestamp in microseconds, the default resolution
+	ts := uint64(t.UnixNano() / 1000)
+	binary.Write(&body, binary.LittleEndian, []uint32{id, uint32(ts >> 32), uint32(ts), uint32(len(data)), uint32(len(data))})
+	body.Write(pad(data))
+	// epb_flags with the direction in the lowest two bits
+	binary.Write(&body, binary.LittleEndian, []uint16{optionPacketFlags, 4})
+	binary.Write(&body, binary.LittleEndian, uint32(dir))
+	binary.Write(&body, binary.LittleEndian, []uint16{optionEnd, 0})
+	return w.writeBlock(blockEnhancedPacket, body.Bytes())
+}
+
+// Get the id of an interface description, writes a new one if necessary
+func (w *Writer) interfaceID(linkType uint16, name string) (uint32, error) {
+	key := string([]byte{byte(linkType >> 8), byte(linkType)}) + name
+	if id, ok := w.interfaces[key]; ok {
+		return id, nil
+	}
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, []uint16{linkType, 0})
+	binary.Write(&body, binary.LittleEndian, uint32(defaultSnapLen))
+	// if_name
+	binary.Write(&body, binary.LittleEndian, []uint16{optionInterfaceName, uint16(len(name))})
+	body.Write(pad([]byte(name)))
+	binary.Write(&body, binary.LittleEndian, []uint16{optionEnd, 0})
+	err := w.writeBlock(blockInterface, body.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	id := uint32(len(w.interfaces))
+	w.interfaces[key] = id
+	return id, nil
+}
+
+// Block type + total length + body + total length
+func (w *Writer) writeBlock(blockType uint32, body []byte) error {
+	l := uint32(len(body) + 12)
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, []uint32{blockType, l})
+	buffer.Write(body)
+	binary.Write(&buffer, binary.LittleEndian, l)
+	_, err := w.w.Write(buffer.Bytes())
+	return err
+}
+
+// Pad b to a multiple of 4 bytes
+func pad(b []byte) []byte {
+	if len(b)%4 == 0 {
+		return b
+	}
+	return append(append([]byte(nil), b...), make([]byte, 4-len(b)%4)...)
+}
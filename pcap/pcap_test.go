@@ -0,0 +1,107 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestWritePacket(t *testing.T) {
+	var buffer bytes.Buffer
+	w, err := NewWriter(&buffer)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	frame := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x08, 0x42, 0xff}
+	now := time.Now()
+	if err := w.WritePacket(LinkTypeEthernet, "eth0", now, frame, Outbound); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := w.WritePacket(LinkTypeEthernet, "eth0", now, frame, Inbound); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := w.WritePacket(LinkTypeRaw, "eth0", now, frame[:5], Outbound); err != nil {
+		t.Fatal(err.Error())
+	}
+	// walk the blocks: SHB, IDB, EPB, EPB, IDB, EPB
+	expected := []uint32{blockSectionHeader, blockInterface, blockEnhancedPacket, blockEnhancedPacket, blockInterface, blockEnhancedPacket}
+	b := buffer.Bytes()
+	for i, blockType := range expected {
+		if len(b) < 12 {
+			t.Fatalf("Block %d is missing", i)
+		}
+		l := binary.LittleEndian.Uint32(b[4:8])
+		if binary.LittleEndian.Uint32(b[0:4]) != blockType {
+			t.Errorf("Block %d has invalid type", i)
+		}
+		if l%4 != 0 || int(l) > len(b) || binary.LittleEndian.Uint32(b[l-4:l]) != l {
+			t.Fatalf("Block %d has invalid length", i)
+		}
+		if blockType == blockEnhancedPacket {
+			id := binary.LittleEndian.Uint32(b[8:12])
+			if (i < 5 && id != 0) || (i == 5 && id != 1) {
+				t.Errorf("Block %d has invalid interface id %d", i, id)
+			}
+		}
+		b = b[l:]
+	}
+	if len(b) != 0 {
+		t.Error("Unexpected trailing bytes")
+	}
+}
+
+func TestReadPacket(t *testing.T) {
+	var buffer bytes.Buffer
+	w, err := NewWriter(&buffer)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	frame := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x08, 0x42, 0xff}
+	now := time.Unix(1500000000, 123000)
+	w.WritePacket(LinkTypeEthernet, "eth0", now, frame, Outbound)
+	w.WritePacket(LinkTypeRaw, "eth0", now, frame[:5], Inbound)
+	r, err := NewReader(&buffer)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []*Packet{{LinkTypeEthernet, now, frame}, {LinkTypeRaw, now, frame[:5]}}
+	for i, e := range expected {
+		p, err := r.ReadPacket()
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if p.LinkType != e.LinkType || !p.Time.Equal(e.Time) || !bytes.Equal(p.Data, e.Data) {
+			t.Errorf("Packet %d differs", i)
+		}
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
+
+func TestReadClassic(t *testing.T) {
+	var buffer bytes.Buffer
+	// big endian, nanosecond resolution
+	binary.Write(&buffer, binary.BigEndian, []uint32{magicNanoseconds, 0x00020004, 0, 0, defaultSnapLen, LinkTypeRaw})
+	binary.Write(&buffer, binary.BigEndian, []uint32{1500000000, 42, 3, 3})
+	buffer.Write([]byte{0x60, 0x00, 0x00})
+	r, err := NewReader(&buffer)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	p, err := r.ReadPacket()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if p.LinkType != LinkTypeRaw || !p.Time.Equal(time.Unix(1500000000, 42)) || len(p.Data) != 3 {
+		t.Error("Packet differs")
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("not a capture"))); err != ErrFormat {
+		t.Errorf("Expected ErrFormat, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Magic numbers of classic pcap files, see https://wiki.wireshark.org/Development/LibpcapFileFormat
+const (
+	magicMicroseconds = 0xA1B2C3D4
+	magicNanoseconds  = 0xA1B23C4D
+	blockSimplePacket = 0x00000003
+	// larger blocks and packets are considered corrupt
+	maxBlockLen = 16 << 20
+)
+
+// ErrFormat is returned for files that are neither pcapng nor classic pcap
+var ErrFormat = errors.New("pcap: unknown file format")
+
+// A packet read from a capture
+type Packet struct {
+	LinkType uint16
+	Time     time.Time // zero for pcapng simple packet blocks
+	Data     []byte
+}
+
+// Reads packets from pcapng files, which may contain several sections and interfaces, and from classic
+// pcap files in either byte order.
+type Reader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	ng    bool
+	// pcapng: link types of the interfaces of the current section
+	linkTypes []uint16
+	// classic pcap
+	linkType   uint16
+	resolution time.Duration
+}
+
+// Constructor, reads the file header
+func NewReader(r io.Reader) (*Reader, error) {
+	pr := &Reader{r: r}
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(magic[:]) == blockSectionHeader {
+		pr.ng = true
+		return pr, pr.readSectionHeader()
+	}
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(magic[:]) {
+		case magicMicroseconds:
+			pr.resolution = time.Microsecond
+		case magicNanoseconds:
+			pr.resolution = time.Nanosecond
+		default:
+			continue
+		}
+		pr.order = order
+		// version, timezone, sigfigs, snaplen, link type
+		var header [20]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, unexpected(err)
+		}
+		pr.linkType = uint16(order.Uint32(header[16:20]))
+		return pr, nil
+	}
+	return nil, ErrFormat
+}
+
+// ReadPacket returns the next packet, io.EOF at the end of the file
+func (r *Reader) ReadPacket() (*Packet, error) {
+	if !r.ng {
+		return r.readRecord()
+	}
+	for {
+		var head [8]byte
+		if _, err := io.ReadFull(r.r, head[:]); err != nil {
+			return nil, err
+		}
+		blockType := r.order.Uint32(head[0:4])
+		if blockType == blockSectionHeader {
+			if err := r.readSectionHeader(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		body, err := r.readBlockBody(r.order.Uint32(head[4:8]))
+		if err != nil {
+			return nil, err
+		}
+		switch blockType {
+		case blockInterface:
+			if len(body) < 8 {
+				return nil, fmt.Errorf("pcap: interface description block is too short")
+			}
+			r.linkTypes = append(r.linkTypes, r.order.Uint16(body[0:2]))
+		case blockEnhancedPacket:
+			if len(body) < 20 {
+				return nil, fmt.Errorf("pcap: enhanced packet block is too short")
+			}
+			id := r.order.Uint32(body[0:4])
+			if int(id) >= len(r.linkTypes) {
+				return nil, fmt.Errorf("pcap: packet of undescribed interface %d", id)
+			}
+			ts := uint64(r.order.Uint32(body[4:8]))<<32 | uint64(r.order.Uint32(body[8:12]))
+			captured := r.order.Uint32(body[12:16])
+			if int(captured) > len(body)-20 {
+				return nil, fmt.Errorf("pcap: enhanced packet block is too short")
+			}
+			// assumes the default resolution of microseconds, if_tsresol is not evaluated
+			return &Packet{
+				LinkType: r.linkTypes[id],
+				Time:     time.Unix(0, int64(ts)*int64(time.Microsecond)),
+				Data:     body[20 : 20+captured],
+			}, nil
+		case blockSimplePacket:
+			if len(body) < 4 || len(r.linkTypes) == 0 {
+				return nil, fmt.Errorf("pcap: invalid simple packet block")
+			}
+			length := r.order.Uint32(body[0:4])
+			if int(length) > len(body)-4 {
+				length = uint32(len(body) - 4)
+			}
+			return &Packet{LinkType: r.linkTypes[0], Data: body[4 : 4+length]}, nil
+		}
+		// other blocks are skipped
+	}
+}
+
+// Read the rest of a section header after its block type, a new section has new interfaces
+func (r *Reader) readSectionHeader() error {
+	var head [8]byte
+	if _, err := io.ReadFull(r.r, head[:]); err != nil {
+		return unexpected(err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(head[4:8]) == byteOrderMagic:
+		r.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(head[4:8]) == byteOrderMagic:
+		r.order = binary.BigEndian
+	default:
+		return ErrFormat
+	}
+	r.linkTypes = nil
+	// the byte order magic is part of the body
+	_, err := r.readBlockBody(r.order.Uint32(head[0:4]) - 4)
+	return err
+}
+
+// Read the block body and the trailing total length, l is the total length of the block
+func (r *Reader) readBlockBody(l uint32) ([]byte, error) {
+	if l < 12 || l%4 != 0 || l > maxBlockLen {
+		return nil, fmt.Errorf("pcap: invalid block length %d", l)
+	}
+	b := make([]byte, l-8)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, unexpected(err)
+	}
+	return b[:len(b)-4], nil
+}
+
+// Read a classic pcap record
+func (r *Reader) readRecord() (*Packet, error) {
+	var head [16]byte
+	if _, err := io.ReadFull(r.r, head[:]); err != nil {
+		return nil, err
+	}
+	captured := r.order.Uint32(head[8:12])
+	if captured > maxBlockLen {
+		return nil, fmt.Errorf("pcap: invalid record length %d", captured)
+	}
+	data := make([]byte, captured)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, unexpected(err)
+	}
+	sec := int64(r.order.Uint32(head[0:4]))
+	frac := int64(r.order.Uint32(head[4:8]))
+	return &Packet{
+		LinkType: r.linkType,
+		Time:     time.Unix(sec, frac*int64(r.resolution)),
+		Data:     data,
+	}, nil
+}
+
+// The file ends within a header or block
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
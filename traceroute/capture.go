@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"grnvs/pcap"
+	"os"
+	"time"
+)
+
+// pcap output, nil without -w
+var capture *pcap.Writer
+
+// Create the capture file, the caller closes it
+func openCapture(name string) (*os.File, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	capture, err = pcap.NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Record a sent or received IPv6 packet, write errors don't stop the tool
+func record(packet []byte, dir pcap.Direction) {
+	if capture == nil {
+		return
+	}
+	err := capture.WritePacket(pcap.LinkTypeRaw, Params.NetworkInterface.Name, time.Now(), packet, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write capture.\n%s\n", err.Error())
+	}
+}
@@ -17,6 +17,8 @@ type AppParams struct {
 	MaxHops          int
 	RemoteAddress    *net.IPAddr
 	LocalAddress     *net.IPAddr
+	CaptureFile      string
+	DryRun           bool
 }
 
 func (p *AppParams) String() string {
@@ -28,13 +30,15 @@ func NewAppParams(args []string) (*AppParams, error) {
 	set := flag.NewFlagSet("trace6", flag.ContinueOnError)
 	// define help
 	set.Usage = func() {
-		fmt.Printf("Usage: %s -i <network inter-face> -t <probe timeout in sec> -q <attempts> -m <max hops> <target addr>\n", path.Base(os.Args[0]))
+		fmt.Printf("Usage: %s -i <network inter-face> -t <probe timeout in sec> -q <attempts> -m <max hops> [-w <file.pcap> [-dry-run]] <target addr>\n", path.Base(os.Args[0]))
 	}
 	// Define console flags
 	i := set.String("i", "eth0", "Network interface; Default is eth0")
 	t := set.Uint("t", 5, "Timeout in seconds; Default: 5")
 	q := set.Int("q", 3, "Max Attempts default is 3")
 	m := set.Int("m", 15, "Max hops default is 15")
+	w := set.String("w", "", "Write sent and received packets to this pcapng file")
+	d := set.Bool("dry-run", false, "Only write the probes to the -w file, no socket is opened")
 	// Try to parse arguments
 	err := set.Parse(args)
 	if err != nil {
@@ -44,6 +48,10 @@ func NewAppParams(args []string) (*AppParams, error) {
 	if set.NArg() != 1 {
 		return nil, errors.New("No target address provided")
 	}
+	// a dry run without capture file would do nothing
+	if *d && *w == "" {
+		return nil, errors.New("-dry-run requires -w")
+	}
 	// parse remote ip
 	rIp, err := net.ResolveIPAddr("ip6", set.Arg(0))
 	if err != nil {
@@ -54,6 +62,8 @@ func NewAppParams(args []string) (*AppParams, error) {
 		Timeout:       time.Duration(*t) * time.Second,
 		Attempts:      *q,
 		MaxHops:       *m,
+		CaptureFile:   *w,
+		DryRun:        *d,
 	}
 	// Find the network interface by its name
 	c.NetworkInterface, err = net.InterfaceByName(*i)
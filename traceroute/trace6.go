@@ -7,6 +7,7 @@ import (
 	"grnvs/icmp6"
 	"grnvs/ipv6"
 	"grnvs/netu"
+	"grnvs/pcap"
 	"math/rand"
 	"net"
 	"os"
@@ -75,6 +76,22 @@ func main() {
 		}
 	}
 
+	// Record packets
+	if Params.CaptureFile != "" {
+		f, err := openCapture(Params.CaptureFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return
+		}
+		defer f.Close()
+	}
+
+	// Only record the probes
+	if Params.DryRun {
+		dryRun()
+		return
+	}
+
 	// Init raw socket for writing (IPPROTO_RAW is only for writing -> man 7 raw)
 	connWrite = createConn(syscall.AF_INET6, syscall.IPPROTO_RAW)
 	defer connWrite.Close()
@@ -87,18 +104,7 @@ func main() {
 	defer syscall.Close(sockRead)
 	defer fileRead.Close()
 
-	// Create the base package, IPv6-Header + ICMP6 Echo Request
-	// Generate id for icmp package
-	id := uint16(rand.Uint32())
-	pck, l := icmp6.NewEchoRequest(id, 0)
-	// craft request package
-	req := &request{
-		Header: ipv6.NewHeader(&Params.LocalAddress.IP, &Params.RemoteAddress.IP),
-		Body:   pck,
-	}
-	// set some ipv6 header values
-	req.Header.NextHeader = 0x3a
-	req.Header.PayloadLen = l
+	req := newRequest()
 
 	chanReply = make(chan *response, 1)
 
@@ -115,6 +121,7 @@ func main() {
 			p := req.Marshal(i, seq)
 			// Send icmp package
 			connWrite.WriteTo(p, Params.RemoteAddress)
+			record(p, pcap.Outbound)
 			// Wait for response
 			resp, err = recvResponse(req, &Params.RemoteAddress.IP)
 			if err != nil {
@@ -139,6 +146,35 @@ func main() {
 	}
 }
 
+// Create the base package, IPv6-Header + ICMP6 Echo Request
+func newRequest() *request {
+	// Generate id for icmp package
+	id := uint16(rand.Uint32())
+	pck, l := icmp6.NewEchoRequest(id, 0)
+	// craft request package
+	req := &request{
+		Header: ipv6.NewHeader(&Params.LocalAddress.IP, &Params.RemoteAddress.IP),
+		Body:   pck,
+	}
+	// set some ipv6 header values
+	req.Header.NextHeader = 0x3a
+	req.Header.PayloadLen = l
+
+	return req
+}
+
+// Record all probes that would be sent without opening a socket
+func dryRun() {
+	req := newRequest()
+	seq := uint16(0)
+	for i := 1; i <= Params.MaxHops; i++ {
+		for j := 0; j < Params.Attempts; j++ {
+			record(req.Marshal(i, seq), pcap.Outbound)
+			seq++
+		}
+	}
+}
+
 func recvResponse(req *request, from *net.IP) (r *response, err error) {
 
 	// package parsing
@@ -154,10 +190,13 @@ func recvResponse(req *request, from *net.IP) (r *response, err error) {
 			if err != nil {
 				continue
 			}
+			// Checksum verification clears the checksum field, keep a copy for the capture
+			packet := append([]byte(nil), buf[:l]...)
 			// Validate destination of the incoming package + Checksum verification
 			if !Params.LocalAddress.IP.Equal(header.Dst) || !icmp6.VerifyChecksum(header, buf[o:l]) {
 				continue
 			}
+			record(packet, pcap.Inbound)
 			// Parse icmp package
 			msg, err := icmp6.Unmarshal(buf[o:l])
 			if err != nil {
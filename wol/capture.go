@@ -0,0 +1,102 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"grnvs/pcap"
+	"net"
+	"os"
+	"time"
+)
+
+//pcap output, nil without -w
+var capture *pcap.Writer
+
+//create the capture file, the caller closes it
+func openCapture(name string) (*os.File, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	capture, err = pcap.NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+//record a sent or received frame, write errors don't stop the tool
+func record(linkType uint16, iface string, data []byte, dir pcap.Direction) {
+	if capture == nil {
+		return
+	}
+	err := capture.WritePacket(linkType, iface, time.Now(), data, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write capture.\n%s\n", err.Error())
+	}
+}
+
+//build the udp datagram the kernel sends for us, including the ip header
+func udpPacket(src, dst *net.UDPAddr, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(b[0:2], uint16(src.Port))
+	binary.BigEndian.PutUint16(b[2:4], uint16(dst.Port))
+	binary.BigEndian.PutUint16(b[4:6], uint16(8+len(payload)))
+	b = append(b, payload...)
+	return ipPacket(src.IP, dst.IP, 17, b, 6)
+}
+
+//put an ip header in front of payload and fill in the transport checksum at
+//csumOffset, a negative offset leaves the payload untouched
+func ipPacket(src, dst net.IP, proto byte, payload []byte, csumOffset int) []byte {
+	v4 := dst.To4() != nil
+	//unspecified source if the kernel picks it
+	if src == nil || src.IsUnspecified() {
+		src = net.IPv6zero
+		if v4 {
+			src = net.IPv4zero
+		}
+	}
+	//pseudo header for the transport checksum
+	var pseudo []byte
+	if v4 {
+		pseudo = append(append([]byte{}, src.To4()...), dst.To4()...)
+		pseudo = append(pseudo, 0, proto, byte(len(payload)>>8), byte(len(payload)))
+	} else {
+		pseudo = append(append([]byte{}, src.To16()...), dst.To16()...)
+		pseudo = append(pseudo, byte(len(payload)>>24), byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload)), 0, 0, 0, proto)
+	}
+	if csumOffset >= 0 {
+		payload[csumOffset] = 0
+		payload[csumOffset+1] = 0
+		csum := checksum(append(pseudo, payload...))
+		//a zero udp checksum means no checksum
+		if csum == 0 && proto == 17 {
+			csum = 0xFFFF
+		}
+		binary.BigEndian.PutUint16(payload[csumOffset:], csum)
+	}
+	if !v4 {
+		h := make([]byte, 40)
+		h[0] = 0x60
+		binary.BigEndian.PutUint16(h[4:6], uint16(len(payload)))
+		h[6] = proto
+		h[7] = 64
+		copy(h[8:24], src.To16())
+		copy(h[24:40], dst.To16())
+		return append(h, payload...)
+	}
+	h := make([]byte, 20)
+	h[0] = 0x45
+	binary.BigEndian.PutUint16(h[2:4], uint16(20+len(payload)))
+	h[6] = 0x40 // don't fragment
+	h[8] = 64
+	h[9] = proto
+	copy(h[12:16], src.To4())
+	copy(h[16:20], dst.To4())
+	binary.BigEndian.PutUint16(h[10:12], checksum(h))
+	return append(h, payload...)
+}
@@ -0,0 +1,290 @@
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"grnvs/wakeonlan"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//a host that can be woken by name
+type host struct {
+	Name      string
+	Mac       net.HardwareAddr
+	Interface string
+	Password  []byte
+	Transport string // raw, udp or udp6
+	Broadcast string
+	Address6  string // destination for udp6
+	Port      uint16
+	IP        net.IP // verification address for -wait
+	//raw frame addressing, negative values are unset
+	Destination string
+	VLAN        int
+	Priority    int
+}
+
+//create a host with unset frame addressing
+func newHost(name string, mac net.HardwareAddr) *host {
+	return &host{
+		Name:     name,
+		Mac:      mac,
+		VLAN:     -1,
+		Priority: -1,
+	}
+}
+
+//fill in the settings h doesn't have from defaults, flags given on the command line (explicit) take precedence
+//over the inventory
+func (h *host) merge(defaults *host, explicit map[string]bool) {
+	if explicit["i"] || h.Interface == "" {
+		h.Interface = defaults.Interface
+	}
+	if explicit["pw"] || h.Password == nil {
+		h.Password = defaults.Password
+	}
+	if explicit["udp"] || explicit["udp6"] || h.Transport == "" {
+		h.Transport = defaults.Transport
+	}
+	if explicit["b"] || h.Broadcast == "" {
+		h.Broadcast = defaults.Broadcast
+	}
+	if explicit["b6"] || h.Address6 == "" {
+		h.Address6 = defaults.Address6
+	}
+	if explicit["p"] || h.Port == 0 {
+		h.Port = defaults.Port
+	}
+	if explicit["ip"] || h.IP == nil {
+		h.IP = defaults.IP
+	}
+	if explicit["dst"] || h.Destination == "" {
+		h.Destination = defaults.Destination
+	}
+	if explicit["vlan"] || h.VLAN < 0 {
+		h.VLAN = defaults.VLAN
+	}
+	if explicit["pcp"] || h.Priority < 0 {
+		h.Priority = defaults.Priority
+	}
+}
+
+//frame options for the raw transport: broadcast, unicast to the target or a custom mac plus optional 802.1Q tag
+func (h *host) frameOptions() (wakeonlan.FrameOptions, error) {
+	var o wakeonlan.FrameOptions
+	switch h.Destination {
+	case "", "broadcast":
+	case "unicast":
+		o.Unicast = true
+	default:
+		mac, err := net.ParseMAC(h.Destination)
+		if err != nil {
+			return o, err
+		}
+		o.Destination = mac
+	}
+	//-1 is untagged, other values must fit the vlan id before they are truncated
+	if h.VLAN < -1 || h.VLAN > 4094 || h.Priority < 0 || h.Priority > 7 {
+		return o, fmt.Errorf("invalid VLAN %d or priority %d", h.VLAN, h.Priority)
+	}
+	//a priority without vlan id results in a priority tag (vlan 0)
+	if h.VLAN >= 0 || h.Priority > 0 {
+		tag := &wakeonlan.VLANTag{}
+		if h.VLAN > 0 {
+			tag.ID = uint16(h.VLAN)
+		}
+		if h.Priority > 0 {
+			tag.Priority = uint8(h.Priority)
+		}
+		if _, err := tag.TCI(); err != nil {
+			return o, err
+		}
+		o.VLAN = tag
+	}
+	return o, nil
+}
+
+//hosts and groups read from /etc/ethers and the wol config file
+type inventory struct {
+	hosts  map[string]*host
+	groups map[string][]string
+}
+
+//load the inventory, missing files are skipped
+func loadInventory(ethersFile, configFile string) (*inventory, error) {
+	inv := &inventory{
+		hosts:  make(map[string]*host),
+		groups: make(map[string][]string),
+	}
+	err := inv.readFile(ethersFile, inv.parseEthersLine)
+	if err != nil {
+		return nil, err
+	}
+	err = inv.readFile(configFile, inv.parseConfigLine)
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+//read name line by line, empty lines and comments are skipped
+func (inv *inventory) readFile(name string, parse func(fields []string) error) error {
+	if name == "" {
+		return nil
+	}
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := scanner.Text()
+		if i := strings.Index(s, "#"); i >= 0 {
+			s = s[:i]
+		}
+		fields := strings.Fields(s)
+		if len(fields) == 0 {
+			continue
+		}
+		if err := parse(fields); err != nil {
+			return fmt.Errorf("%s:%d: %s", name, line, err.Error())
+		}
+	}
+	return scanner.Err()
+}
+
+//get or create a host entry
+func (inv *inventory) host(name string) *host {
+	h, ok := inv.hosts[name]
+	if !ok {
+		h = newHost(name, nil)
+		inv.hosts[name] = h
+	}
+	return h
+}
+
+// /etc/ethers: <mac> <hostname>
+func (inv *inventory) parseEthersLine(fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("expected <mac> <hostname>")
+	}
+	mac, err := net.ParseMAC(fields[0])
+	if err != nil {
+		return err
+	}
+	inv.host(fields[1]).Mac = mac
+	return nil
+}
+
+// host <name> [mac=<mac>] [interface=<name>] [password=<hex>] [transport=raw|udp|udp6] [broadcast=<addr>] [address6=<addr>] [port=<port>] [ip=<addr>]
+//      [dst=broadcast|unicast|<mac>] [vlan=<id>] [pcp=<priority>]
+// group <name> <host>...
+func (inv *inventory) parseConfigLine(fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("expected host or group definition")
+	}
+	switch fields[0] {
+	case "group":
+		inv.groups[fields[1]] = append(inv.groups[fields[1]], fields[2:]...)
+		return nil
+	case "host":
+	default:
+		return fmt.Errorf("unknown keyword %s", fields[0])
+	}
+	h := inv.host(fields[1])
+	for _, field := range fields[2:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("expected key=value, got %s", field)
+		}
+		var err error
+		switch kv[0] {
+		case "mac":
+			h.Mac, err = net.ParseMAC(kv[1])
+		case "interface":
+			h.Interface = kv[1]
+		case "password":
+			h.Password, err = wakeonlan.ParsePassword(kv[1])
+		case "transport":
+			if kv[1] != "raw" && kv[1] != "udp" && kv[1] != "udp6" {
+				return fmt.Errorf("unknown transport %s", kv[1])
+			}
+			h.Transport = kv[1]
+		case "broadcast":
+			h.Broadcast = kv[1]
+		case "address6":
+			h.Address6 = kv[1]
+		case "port":
+			var port uint64
+			port, err = strconv.ParseUint(kv[1], 10, 16)
+			h.Port = uint16(port)
+		case "ip":
+			h.IP = net.ParseIP(kv[1])
+			if h.IP == nil {
+				return fmt.Errorf("%s is no valid IP address", kv[1])
+			}
+		case "dst":
+			h.Destination = kv[1]
+		case "vlan":
+			h.VLAN, err = strconv.Atoi(kv[1])
+			if err == nil && (h.VLAN < -1 || h.VLAN > 4094) {
+				return fmt.Errorf("VLAN %d is not between 0 and 4094", h.VLAN)
+			}
+		case "pcp":
+			h.Priority, err = strconv.Atoi(kv[1])
+			if err == nil && (h.Priority < 0 || h.Priority > 7) {
+				return fmt.Errorf("priority %d is not between 0 and 7", h.Priority)
+			}
+		default:
+			return fmt.Errorf("unknown key %s", kv[0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//resolve a host name or @group to hosts with mac addresses
+func (inv *inventory) resolve(arg string) ([]*host, error) {
+	if strings.HasPrefix(arg, "@") {
+		members, ok := inv.groups[arg[1:]]
+		if !ok {
+			return nil, fmt.Errorf("unknown group %s", arg[1:])
+		}
+		//groups only contain hosts, no nested groups
+		var hosts []*host
+		for _, member := range members {
+			h, err := inv.lookup(member)
+			if err != nil {
+				return nil, err
+			}
+			hosts = append(hosts, h)
+		}
+		return hosts, nil
+	}
+	h, err := inv.lookup(arg)
+	if err != nil {
+		return nil, err
+	}
+	return []*host{h}, nil
+}
+
+func (inv *inventory) lookup(name string) (*host, error) {
+	h, ok := inv.hosts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown host %s", name)
+	}
+	if h.Mac == nil {
+		return nil, fmt.Errorf("host %s has no MAC address", name)
+	}
+	return h, nil
+}
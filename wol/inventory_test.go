@@ -0,0 +1,155 @@
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//write the files into a temporary directory and load them as inventory
+func testInventory(t *testing.T, ethers, config string) (*inventory, error) {
+	dir, err := ioutil.TempDir("", "wol")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	ethersFile := filepath.Join(dir, "ethers")
+	configFile := filepath.Join(dir, "wol.conf")
+	if err := ioutil.WriteFile(ethersFile, []byte(ethers), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := ioutil.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	return loadInventory(ethersFile, configFile)
+}
+
+func TestInventory(t *testing.T) {
+	ethers := `# comment
+00:11:22:33:44:55 nas # trailing comment
+
+00:11:22:33:44:66 desktop
+`
+	config := `host desktop mac=00:11:22:33:44:77 transport=udp port=7
+host printer interface=eth1
+host tagged mac=00:11:22:33:44:88 vlan=10 pcp=5
+group office nas desktop
+group broken nas printer
+`
+	inv, err := testInventory(t, ethers, config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tests := []struct {
+		arg   string
+		macs  string
+		error string
+	}{
+		{"nas", "00:11:22:33:44:55", ""},
+		//the config file overrides /etc/ethers
+		{"desktop", "00:11:22:33:44:77", ""},
+		{"@office", "00:11:22:33:44:55 00:11:22:33:44:77", ""},
+		{"printer", "", "has no MAC address"},
+		{"@broken", "", "has no MAC address"},
+		{"@unknown", "", "unknown group"},
+		{"unknown", "", "unknown host"},
+	}
+	for _, test := range tests {
+		hosts, err := inv.resolve(test.arg)
+		if test.error != "" {
+			if err == nil || !strings.Contains(err.Error(), test.error) {
+				t.Errorf("%s: expected error %q, got %v", test.arg, test.error, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.arg, err.Error())
+			continue
+		}
+		var macs []string
+		for _, h := range hosts {
+			macs = append(macs, h.Mac.String())
+		}
+		if strings.Join(macs, " ") != test.macs {
+			t.Errorf("%s resolves to %v", test.arg, macs)
+		}
+	}
+	h := inv.hosts["tagged"]
+	if o, err := h.frameOptions(); err != nil || o.VLAN == nil || o.VLAN.ID != 10 || o.VLAN.Priority != 5 {
+		t.Errorf("Frame options of tagged are %+v, %v", o, err)
+	}
+}
+
+func TestInventoryErrors(t *testing.T) {
+	tests := []struct {
+		ethers string
+		config string
+		error  string
+	}{
+		{"00:11:22:33:44 nas\n", "", "ethers:1"},
+		{"00:11:22:33:44:55\n", "", "expected <mac> <hostname>"},
+		{"", "host nas mac=zz\n", "wol.conf:1"},
+		{"", "\n# comment\nhost nas pcp=-1\n", "wol.conf:3"},
+		{"", "host nas pcp=8\n", "priority"},
+		{"", "host nas vlan=-5\n", "VLAN -5"},
+		{"", "host nas vlan=4095\n", "VLAN 4095"},
+		{"", "host nas transport=tcp\n", "unknown transport"},
+		{"", "host nas color=blue\n", "unknown key"},
+		{"", "machine nas\n", "unknown keyword"},
+	}
+	for _, test := range tests {
+		_, err := testInventory(t, test.ethers, test.config)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%q %q: expected error %q, got %v", test.ethers, test.config, test.error, err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	defaults := &host{Interface: "eth0", Transport: "raw", Port: 9, VLAN: -1, Priority: 0}
+	inv, err := testInventory(t, "", "host nas mac=00:11:22:33:44:55 interface=eth1 transport=udp port=7 vlan=10\n")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	//the inventory wins over defaults
+	h := *inv.hosts["nas"]
+	h.merge(defaults, map[string]bool{})
+	if h.Interface != "eth1" || h.Transport != "udp" || h.Port != 7 || h.VLAN != 10 || h.Priority != 0 {
+		t.Errorf("Merged host is %+v", h)
+	}
+	//explicit flags win over the inventory
+	h = *inv.hosts["nas"]
+	h.merge(defaults, map[string]bool{"i": true, "p": true, "vlan": true})
+	if h.Interface != "eth0" || h.Transport != "udp" || h.Port != 9 || h.VLAN != -1 {
+		t.Errorf("Merged host is %+v", h)
+	}
+}
+
+func TestFrameOptionsVLAN(t *testing.T) {
+	tests := []struct {
+		vlan, pcp int
+		tagged    bool
+		valid     bool
+	}{
+		{-1, 0, false, true},
+		{-1, 3, true, true},
+		{0, 0, true, true},
+		{4094, 7, true, true},
+		{-2, 0, false, false},
+		{-5, 3, false, false},
+		{4095, 0, false, false},
+		{65540, 0, false, false},
+		{10, 8, false, false},
+	}
+	for _, test := range tests {
+		h := &host{VLAN: test.vlan, Priority: test.pcp}
+		o, err := h.frameOptions()
+		if (err == nil) != test.valid || err == nil && (o.VLAN != nil) != test.tagged {
+			t.Errorf("vlan %d pcp %d: got %+v, %v", test.vlan, test.pcp, o.VLAN, err)
+		}
+	}
+}
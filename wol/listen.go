@@ -0,0 +1,171 @@
+// +build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"grnvs/pcap"
+	"grnvs/wakeonlan"
+	"net"
+	"os"
+	"path"
+	"syscall"
+	"time"
+)
+
+//a magic packet seen on the wire
+type sighting struct {
+	Time    time.Time
+	SrcMac  net.HardwareAddr
+	SrcIP   net.IP // nil for raw ethernet frames
+	SrcPort uint16
+	Packet  *wakeonlan.MagicPacket
+}
+
+func (s *sighting) String() string {
+	src := "-"
+	if s.SrcIP != nil {
+		src = net.JoinHostPort(s.SrcIP.String(), fmt.Sprint(s.SrcPort))
+	}
+	secureOn := "no"
+	if s.Packet.Password != nil {
+		secureOn = "yes"
+	}
+	return fmt.Sprintf("%s src-mac %s src-ip %s target %s secureon %s", s.Time.Format(time.RFC3339Nano), s.SrcMac, src, s.Packet.Target, secureOn)
+}
+
+//wol listen -i <interface>
+func listen(args []string) {
+	//create new flag set
+	set := flag.NewFlagSet("listen", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Printf("Usage: %s listen -i <network-interface> [-w <file.pcap>]\n", path.Base(os.Args[0]))
+	}
+	interfaceName := set.String("i", "eth0", "Network interface; Default is eth0")
+	captureFile := set.String("w", "", "Write the decoded frames to this pcapng file")
+	set.Parse(args)
+	//record frames
+	if *captureFile != "" {
+		f, err := openCapture(*captureFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to create %s.\n%s\n", *captureFile, err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
+	//find the network interface by its name
+	networkInterface, err := net.InterfaceByName(*interfaceName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "The selected network interface %s does not exist.\n", *interfaceName)
+		os.Exit(1)
+	}
+	//create raw socket
+	socket, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(wakeonlan.Htons(syscall.ETH_P_ALL)))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to create socket.")
+		os.Exit(2)
+	}
+	defer syscall.Close(socket)
+	//only listen on the selected interface
+	err = syscall.Bind(socket, &syscall.SockaddrLinklayer{
+		Protocol: wakeonlan.Htons(syscall.ETH_P_ALL),
+		Ifindex:  networkInterface.Index,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to bind to %s.\n", networkInterface.Name)
+		os.Exit(2)
+	}
+	buffer := make([]byte, 65536)
+	for {
+		n, from, err := syscall.Recvfrom(socket, buffer, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to read from socket.")
+			os.Exit(2)
+		}
+		//the loopback device shows every frame twice
+		if ll, ok := from.(*syscall.SockaddrLinklayer); ok && ll.Pkttype == syscall.PACKET_OUTGOING && networkInterface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if s := decodeFrame(buffer[:n], time.Now()); s != nil {
+			record(pcap.LinkTypeEthernet, networkInterface.Name, buffer[:n], pcap.Inbound)
+			fmt.Println(s)
+		}
+	}
+}
+
+//decode raw wol frames and udp datagrams to port 7 or 9, returns nil for anything else
+func decodeFrame(frame []byte, t time.Time) *sighting {
+	if len(frame) < 14 {
+		return nil
+	}
+	s := &sighting{
+		Time:   t,
+		SrcMac: net.HardwareAddr(append([]byte(nil), frame[6:12]...)),
+	}
+	//skip an 802.1Q tag
+	if binary.BigEndian.Uint16(frame[12:14]) == wakeonlan.VLANEtherType {
+		if len(frame) < 18 {
+			return nil
+		}
+		frame = append(frame[:12:12], frame[16:]...)
+	}
+	var payload []byte
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case wakeonlan.EtherType:
+		payload = frame[14:]
+	case 0x0800:
+		//ipv4 header with variable length
+		if len(frame) < 34 || frame[23] != syscall.IPPROTO_UDP {
+			return nil
+		}
+		ihl := int(frame[14]&0x0f) * 4
+		if ihl < 20 || len(frame) < 14+ihl+8 {
+			return nil
+		}
+		//fragments can't be decoded on their own, only unfragmented datagrams carry a whole magic packet
+		if binary.BigEndian.Uint16(frame[20:22])&0x3fff != 0 {
+			return nil
+		}
+		s.SrcIP = net.IP(append([]byte(nil), frame[26:30]...))
+		payload = udpPayload(frame[14+ihl:], &s.SrcPort)
+	case 0x86DD:
+		//ipv6 header without extension headers
+		if len(frame) < 54 || frame[20] != syscall.IPPROTO_UDP {
+			return nil
+		}
+		s.SrcIP = net.IP(append([]byte(nil), frame[22:38]...))
+		payload = udpPayload(frame[54:], &s.SrcPort)
+	}
+	if payload == nil {
+		return nil
+	}
+	//some senders append trailing bytes, decode them without password then
+	packet := new(wakeonlan.MagicPacket)
+	if packet.Unmarshal(payload) != nil {
+		if len(payload) < wakeonlan.PayloadLen || packet.Unmarshal(payload[:wakeonlan.PayloadLen]) != nil {
+			return nil
+		}
+	}
+	s.Packet = packet
+	return s
+}
+
+//returns the payload of udp datagrams to port 7 or 9
+func udpPayload(b []byte, srcPort *uint16) []byte {
+	if len(b) < 8 {
+		return nil
+	}
+	dstPort := binary.BigEndian.Uint16(b[2:4])
+	if dstPort != 7 && dstPort != 9 {
+		return nil
+	}
+	*srcPort = binary.BigEndian.Uint16(b[0:2])
+	//the udp length excludes any ethernet padding
+	l := int(binary.BigEndian.Uint16(b[4:6]))
+	if l < 8 || l > len(b) {
+		return nil
+	}
+	return b[8:l]
+}
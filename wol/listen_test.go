@@ -0,0 +1,52 @@
+// +build linux
+
+package main
+
+import (
+	"grnvs/wakeonlan"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDecodeFrame(t *testing.T) {
+	target, _ := net.ParseMAC("00:11:22:33:44:55")
+	p, _ := wakeonlan.NewMagicPacket(target, nil)
+	payload, _ := p.Marshal()
+	src := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 40000}
+	dst := &net.UDPAddr{IP: net.ParseIP("10.0.0.255"), Port: 9}
+	header := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x08, 0x00}
+	udp := append(append([]byte(nil), header...), udpPacket(src, dst, payload)...)
+	raw := append([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x08, 0x42}, payload...)
+	//copy of the udp frame changed by f
+	change := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), udp...))
+	}
+	tests := []struct {
+		name  string
+		frame []byte
+		valid bool
+	}{
+		{"raw", raw, true},
+		{"udp", udp, true},
+		{"truncated ethernet", udp[:10], false},
+		{"truncated ip", udp[:30], false},
+		{"truncated udp", udp[:40], false},
+		{"ihl below 5", change(func(b []byte) []byte { b[14] = 0x44; return b }), false},
+		{"ihl 15 on short frame", change(func(b []byte) []byte { b[14] = 0x4f; return b[:40] }), false},
+		{"ihl 15", change(func(b []byte) []byte { b[14] = 0x4f; return b }), false},
+		{"more fragments", change(func(b []byte) []byte { b[20] = 0x20; return b }), false},
+		{"fragment offset", change(func(b []byte) []byte { b[21] = 0x10; return b }), false},
+		{"other port", change(func(b []byte) []byte { b[37] = 10; return b }), false},
+	}
+	for _, test := range tests {
+		s := decodeFrame(test.frame, time.Now())
+		if (s != nil) != test.valid {
+			t.Errorf("%s: decoded %t, expected %t", test.name, s != nil, test.valid)
+			continue
+		}
+		if s != nil && s.Packet.Target.String() != target.String() {
+			t.Errorf("%s: target is %s", test.name, s.Packet.Target)
+		}
+	}
+}
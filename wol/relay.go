@@ -0,0 +1,223 @@
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"grnvs/pcap"
+	"grnvs/wakeonlan"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//sliding window rate limiter keyed by target or source
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+	//keys of sources that never come back are forgotten once per window
+	lastExpire time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+//Allowed returns false if a hit for key would exceed the limit, the hit is not recorded
+func (r *rateLimiter) Allowed(key string, now time.Time) bool {
+	if now.Sub(r.lastExpire) >= r.window {
+		for k := range r.hits {
+			r.prune(k, now)
+		}
+		r.lastExpire = now
+	}
+	return len(r.prune(key, now)) < r.limit
+}
+
+//Record a hit for key
+func (r *rateLimiter) Record(key string, now time.Time) {
+	r.hits[key] = append(r.prune(key, now), now)
+}
+
+//Allow records a hit for key and returns false if the limit is exceeded
+func (r *rateLimiter) Allow(key string, now time.Time) bool {
+	if !r.Allowed(key, now) {
+		return false
+	}
+	r.Record(key, now)
+	return true
+}
+
+//forget the hits of key that left the window, and the key once it has none
+func (r *rateLimiter) prune(key string, now time.Time) []time.Time {
+	hits := r.hits[key]
+	i := 0
+	for i < len(hits) && now.Sub(hits[i]) >= r.window {
+		i++
+	}
+	hits = hits[i:]
+	if len(hits) == 0 {
+		delete(r.hits, key)
+		return nil
+	}
+	r.hits[key] = hits
+	return hits
+}
+
+//read one mac address per line, empty lines and lines starting with # are ignored
+func readAllowlist(name string) (map[string]bool, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	allowed := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		mac, err := net.ParseMAC(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, line, err.Error())
+		}
+		allowed[mac.String()] = true
+	}
+	return allowed, scanner.Err()
+}
+
+//log one relay event as key=value line
+func logEvent(event string, src net.Addr, target string, fields ...string) {
+	line := fmt.Sprintf("time=%s event=%s src=%s target=%s", time.Now().Format(time.RFC3339), event, src, target)
+	if len(fields) > 0 {
+		line += " " + strings.Join(fields, " ")
+	}
+	fmt.Println(line)
+}
+
+//wol relay -l <listen-address> -i <interfaces> -allow <file>
+func relay(args []string) {
+	//create new flag set
+	set := flag.NewFlagSet("relay", flag.ExitOnError)
+	set.Usage = func() {
+		fmt.Printf("Usage: %s relay -l <listen-address> -i <network-interface>[,<network-interface>...] -allow <file> [-w <file.pcap>]\n", path.Base(os.Args[0]))
+		set.PrintDefaults()
+	}
+	listenAddr := set.String("l", ":9", "UDP address to receive magic packets on; Default is :9")
+	interfaceNames := set.String("i", "eth0", "Comma separated network interfaces to broadcast on; Default is eth0")
+	allowFile := set.String("allow", "", "File with one allowed target MAC address per line")
+	targetLimit := set.Int("target-limit", 3, "Max relayed wakes per target and window; Default is 3")
+	sourceLimit := set.Int("source-limit", 20, "Max relayed wakes per source address and window; Default is 20")
+	window := set.Duration("window", time.Minute, "Rate limit window; Default is 1m")
+	captureFile := set.String("w", "", "Write received wakes and relayed frames to this pcapng file")
+	set.Parse(args)
+	if *allowFile == "" {
+		set.Usage()
+		os.Exit(1)
+	}
+	//load allowed targets
+	allowed, err := readAllowlist(*allowFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read allowlist.\n%s\n", err.Error())
+		os.Exit(1)
+	}
+	//open a raw sender for each interface
+	var senders []*wakeonlan.RawSender
+	for _, name := range strings.Split(*interfaceNames, ",") {
+		networkInterface, err := net.InterfaceByName(strings.TrimSpace(name))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "The selected network interface %s does not exist.\n", name)
+			os.Exit(1)
+		}
+		sender, err := wakeonlan.NewRawSender(networkInterface)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to create socket.\n%s\n", err.Error())
+			os.Exit(2)
+		}
+		defer sender.Close()
+		senders = append(senders, sender)
+	}
+	//listen for routed wakes
+	laddr, err := net.ResolveUDPAddr("udp", *listenAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s is no valid listen address.\n", *listenAddr)
+		os.Exit(1)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to listen on %s.\n%s\n", *listenAddr, err.Error())
+		os.Exit(2)
+	}
+	defer conn.Close()
+	//record frames
+	if *captureFile != "" {
+		f, err := openCapture(*captureFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to create %s.\n%s\n", *captureFile, err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
+	targetLimiter := newRateLimiter(*targetLimit, *window)
+	sourceLimiter := newRateLimiter(*sourceLimit, *window)
+	buffer := make([]byte, 1500)
+	for {
+		n, src, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read from socket.\n%s\n", err.Error())
+			os.Exit(2)
+		}
+		if capture != nil {
+			//a dual stack socket reports :: as local address for ipv4 senders
+			local := *conn.LocalAddr().(*net.UDPAddr)
+			if src.IP.To4() != nil && local.IP.IsUnspecified() {
+				local.IP = net.IPv4zero
+			}
+			record(pcap.LinkTypeRaw, "udp", udpPacket(src, &local, append([]byte(nil), buffer[:n]...)), pcap.Inbound)
+		}
+		//validate the payload
+		packet := new(wakeonlan.MagicPacket)
+		if err := packet.Unmarshal(buffer[:n]); err != nil {
+			logEvent("drop", src, "-", "reason=invalid")
+			continue
+		}
+		target := packet.Target.String()
+		now := time.Now()
+		if !allowed[target] {
+			logEvent("drop", src, target, "reason=not-allowed")
+			continue
+		}
+		//a rejected wake doesn't use up the budget of the other limit
+		if !sourceLimiter.Allowed(src.IP.String(), now) {
+			logEvent("drop", src, target, "reason=source-rate-limit")
+			continue
+		}
+		if !targetLimiter.Allowed(target, now) {
+			logEvent("drop", src, target, "reason=target-rate-limit")
+			continue
+		}
+		sourceLimiter.Record(src.IP.String(), now)
+		targetLimiter.Record(target, now)
+		//broadcast on every interface
+		for _, sender := range senders {
+			if err := sender.Send(packet); err != nil {
+				logEvent("error", src, target, "interface="+sender.Interface().Name, fmt.Sprintf("error=%q", err.Error()))
+				continue
+			}
+			if frame, err := sender.Frame(packet); err == nil {
+				record(pcap.LinkTypeEthernet, sender.Interface().Name, frame, pcap.Outbound)
+			}
+			logEvent("relay", src, target, "interface="+sender.Interface().Name, fmt.Sprintf("secureon=%t", packet.Password != nil))
+		}
+	}
+}
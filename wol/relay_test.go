@@ -0,0 +1,42 @@
+// +build linux
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	r := newRateLimiter(2, time.Minute)
+	tests := []struct {
+		key     string
+		offset  time.Duration
+		allowed bool
+	}{
+		{"a", 0, true},
+		{"a", time.Second, true},
+		{"a", 2 * time.Second, false},
+		//keys are independent
+		{"b", 3 * time.Second, true},
+		//the first hit of a left the window
+		{"a", time.Minute, true},
+		{"a", time.Minute + time.Second/2, false},
+		{"a", time.Minute + time.Second, true},
+	}
+	for i, test := range tests {
+		if r.Allow(test.key, start.Add(test.offset)) != test.allowed {
+			t.Errorf("Hit %d of %s is allowed %t", i, test.key, !test.allowed)
+		}
+	}
+	//a rejected hit is not recorded
+	if r.Allowed("c", start) != true || len(r.hits["c"]) != 0 {
+		t.Error("Allowed recorded a hit")
+	}
+	//b and a are forgotten once their windows passed
+	r.Allow("c", start.Add(10*time.Minute))
+	if len(r.hits) != 1 {
+		t.Errorf("Limiter keeps %d keys", len(r.hits))
+	}
+}
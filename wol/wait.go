@@ -0,0 +1,177 @@
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"grnvs/pcap"
+	"grnvs/wakeonlan"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+//watches an interface for signs of life from a woken host
+type watcher struct {
+	iface  *net.Interface
+	socket int
+	target net.HardwareAddr
+	ip     net.IP
+	//used to send icmp echo requests to ip
+	echoConn net.PacketConn
+	echoID   uint16
+	echoSeq  uint16
+	lastEcho time.Time
+}
+
+func newWatcher(iface *net.Interface, target net.HardwareAddr, ip net.IP) (*watcher, error) {
+	w := &watcher{
+		iface:  iface,
+		target: target,
+		ip:     ip,
+		echoID: uint16(os.Getpid()),
+	}
+	//create raw socket to see every frame on the interface
+	var err error
+	w.socket, err = syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(wakeonlan.Htons(syscall.ETH_P_ALL)))
+	if err != nil {
+		return nil, err
+	}
+	//only listen on the selected interface
+	err = syscall.Bind(w.socket, &syscall.SockaddrLinklayer{
+		Protocol: wakeonlan.Htons(syscall.ETH_P_ALL),
+		Ifindex:  iface.Index,
+	})
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	//wake up once a second to check the deadline and to send echo requests
+	tv := syscall.NsecToTimeval(int64(time.Second))
+	err = syscall.SetsockoptTimeval(w.socket, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	//open icmp socket to probe the given address
+	if ip != nil {
+		if ip.To4() != nil {
+			w.echoConn, err = net.ListenPacket("ip4:icmp", "0.0.0.0")
+		} else {
+			w.echoConn, err = net.ListenPacket("ip6:ipv6-icmp", "::")
+		}
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *watcher) Close() {
+	if w.echoConn != nil {
+		w.echoConn.Close()
+	}
+	syscall.Close(w.socket)
+}
+
+//Wait returns true as soon as the target is seen or false after timeout
+func (w *watcher) Wait(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	buffer := make([]byte, 1518)
+	for time.Now().Before(deadline) {
+		w.sendEcho()
+		n, _, err := syscall.Recvfrom(w.socket, buffer, 0)
+		if err != nil {
+			//read timeout, check deadline again
+			continue
+		}
+		if w.isAlive(buffer[:n]) {
+			record(pcap.LinkTypeEthernet, w.iface.Name, buffer[:n], pcap.Inbound)
+			return true
+		}
+	}
+	return false
+}
+
+//send an echo request to the target ip, at most once a second
+func (w *watcher) sendEcho() {
+	if w.echoConn == nil || time.Since(w.lastEcho) < time.Second {
+		return
+	}
+	w.lastEcho = time.Now()
+	w.echoSeq++
+	msg := []byte{0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(msg[4:6], w.echoID)
+	binary.BigEndian.PutUint16(msg[6:8], w.echoSeq)
+	if w.ip.To4() != nil {
+		//echo request, checksum has to be calculated by us
+		msg[0] = 8
+		binary.BigEndian.PutUint16(msg[2:4], checksum(msg))
+	} else {
+		//echo request, the kernel calculates the icmpv6 checksum
+		msg[0] = 128
+	}
+	//errors are ignored, the host is probably still asleep
+	_, err := w.echoConn.WriteTo(msg, &net.IPAddr{IP: w.ip})
+	if err == nil && capture != nil {
+		//the kernel adds the ip header and the icmpv6 checksum
+		if w.ip.To4() != nil {
+			record(pcap.LinkTypeRaw, w.iface.Name, ipPacket(nil, w.ip, 1, msg, -1), pcap.Outbound)
+		} else {
+			record(pcap.LinkTypeRaw, w.iface.Name, ipPacket(nil, w.ip, 58, msg, 2), pcap.Outbound)
+		}
+	}
+}
+
+//checks whether a frame was sent by the woken host
+func (w *watcher) isAlive(frame []byte) bool {
+	if len(frame) < 14 {
+		return false
+	}
+	fromTarget := bytes.Equal(frame[6:12], w.target)
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case 0x0806:
+		//any arp message from the target
+		return fromTarget
+	case 0x86DD:
+		//ipv6 header (40 byte) + icmpv6 type
+		if len(frame) < 55 || frame[20] != 0x3a {
+			return false
+		}
+		icmpType := frame[54]
+		//router/neighbor solicitations and advertisements from the target
+		if fromTarget && icmpType >= 133 && icmpType <= 137 {
+			return true
+		}
+		//echo reply from the verification address
+		return w.ip != nil && icmpType == 129 && w.ip.Equal(net.IP(frame[22:38]))
+	case 0x0800:
+		//echo reply from the verification address
+		if w.ip == nil || w.ip.To4() == nil || len(frame) < 34 {
+			return false
+		}
+		ihl := int(frame[14]&0x0f) * 4
+		if frame[23] != 1 || ihl < 20 || len(frame) < 14+ihl+1 {
+			return false
+		}
+		return frame[14+ihl] == 0 && w.ip.Equal(net.IP(frame[26:30]))
+	}
+	return false
+}
+
+//internet checksum (RFC 1071)
+func checksum(b []byte) uint16 {
+	s := uint32(0)
+	for i := 0; i < len(b)-1; i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)&1 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+	s = s>>16 + s&0xffff
+	s = s + s>>16
+	return ^uint16(s)
+}
@@ -0,0 +1,47 @@
+// +build linux
+
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsAlive(t *testing.T) {
+	target, _ := net.ParseMAC("00:11:22:33:44:55")
+	other := []byte{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	ether := func(src []byte, etherType uint16) []byte {
+		return append(append([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, src...), byte(etherType>>8), byte(etherType))
+	}
+	arp := append(ether(target, 0x0806), make([]byte, 28)...)
+	//icmp echo reply from 10.0.0.2
+	echo4 := append(ether(other, 0x0800), ipPacket(net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1"), 1, make([]byte, 8), -1)...)
+	//neighbor advertisement from the target
+	na := append(ether(target, 0x86DD), ipPacket(net.ParseIP("fe80::1"), net.ParseIP("ff02::1"), 58, append([]byte{136}, make([]byte, 23)...), 2)...)
+	change := func(b []byte, f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), b...))
+	}
+	w := &watcher{target: target, ip: net.ParseIP("10.0.0.2")}
+	tests := []struct {
+		name  string
+		frame []byte
+		alive bool
+	}{
+		{"arp", arp, true},
+		{"arp of others", change(arp, func(b []byte) []byte { copy(b[6:12], other); return b }), false},
+		{"echo reply", echo4, true},
+		{"echo request", change(echo4, func(b []byte) []byte { b[34] = 8; return b }), false},
+		{"neighbor advertisement", na, true},
+		{"empty", nil, false},
+		{"truncated ethernet", arp[:13], false},
+		{"truncated ipv4", echo4[:33], false},
+		{"ihl below 5", change(echo4, func(b []byte) []byte { b[14] = 0x44; return b }), false},
+		{"ihl 15", change(echo4, func(b []byte) []byte { b[14] = 0x4f; return b }), false},
+		{"truncated ipv6", na[:54], false},
+	}
+	for _, test := range tests {
+		if w.isAlive(test.frame) != test.alive {
+			t.Errorf("%s: alive %t, expected %t", test.name, !test.alive, test.alive)
+		}
+	}
+}
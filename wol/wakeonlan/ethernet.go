@@ -0,0 +1,87 @@
+package wakeonlan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+)
+
+const (
+	VLANEtherType = 0x8100 // IEEE 802.1Q
+)
+
+// The ethernet header
+type EtherHeader struct {
+	DHost [6]byte
+	SHost [6]byte
+	Type  uint16
+}
+
+// IEEE 802.1Q tag, ID 0 only carries the priority
+type VLANTag struct {
+	ID       uint16 // 12 bit VLAN identifier
+	Priority uint8  // 3 bit priority code point
+}
+
+// Tag control information: 3 bit PCP + 1 bit DEI + 12 bit VID
+func (t *VLANTag) TCI() (uint16, error) {
+	if t.ID >= 0xFFF {
+		return 0, errors.New("VLAN ID must be between 0 and 4094")
+	}
+	if t.Priority > 7 {
+		return 0, errors.New("VLAN priority must be between 0 and 7")
+	}
+	return uint16(t.Priority)<<13 | t.ID, nil
+}
+
+// Addressing of raw wake on lan frames
+type FrameOptions struct {
+	// Destination MAC, nil means broadcast
+	Destination net.HardwareAddr
+	// Send the frame to the target MAC itself, overrides Destination
+	Unicast bool
+	// Optional 802.1Q tag
+	VLAN *VLANTag
+}
+
+// Build the complete ethernet frame for p sent from src
+func NewFrame(src net.HardwareAddr, p *MagicPacket, o FrameOptions) ([]byte, error) {
+	if len(src) != 6 {
+		return nil, errors.New("Source is no 48 bit MAC address")
+	}
+	header := EtherHeader{
+		DHost: [6]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, // MAC Broadcast
+		Type:  EtherType,
+	}
+	if o.Unicast {
+		copy(header.DHost[:], p.Target)
+	} else if o.Destination != nil {
+		if len(o.Destination) != 6 {
+			return nil, errors.New("Destination is no 48 bit MAC address")
+		}
+		copy(header.DHost[:], o.Destination)
+	}
+	// copy the mac address of the interface to the ether_header
+	copy(header.SHost[:], src[0:6])
+	// encode addresses
+	var buffer bytes.Buffer
+	buffer.Write(header.DHost[:])
+	buffer.Write(header.SHost[:])
+	// the tag is inserted between source address and ether type
+	if o.VLAN != nil {
+		tci, err := o.VLAN.TCI()
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buffer, binary.BigEndian, []uint16{VLANEtherType, tci})
+	}
+	binary.Write(&buffer, binary.BigEndian, header.Type)
+	// append payload
+	payload, err := p.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	buffer.Write(payload)
+	return buffer.Bytes(), nil
+}
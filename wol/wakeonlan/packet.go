@@ -0,0 +1,115 @@
+package wakeonlan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+)
+
+const (
+	EtherType  = 0x0842 // https://wiki.wireshark.org/WakeOnLAN
+	PayloadLen = 102    // sync stream + 16 times the target address
+)
+
+// Wake on lan payload as it is put on the wire
+type Payload struct {
+	Sync   [6]byte
+	Target [96]byte
+}
+
+// A magic packet for one target, optionally protected by a SecureOn password
+type MagicPacket struct {
+	Target   net.HardwareAddr
+	Password []byte
+}
+
+// Constructor, the password may be nil
+func NewMagicPacket(target net.HardwareAddr, password []byte) (*MagicPacket, error) {
+	if len(target) != 6 {
+		return nil, errors.New("Target is no 48 bit MAC address")
+	}
+	if password != nil && len(password) != 4 && len(password) != 6 {
+		return nil, errors.New("SecureOn password must be 4 or 6 bytes long")
+	}
+	return &MagicPacket{
+		Target:   target,
+		Password: password,
+	}, nil
+}
+
+// Get the payload struct without password
+func (p *MagicPacket) Payload() Payload {
+	payload := Payload{
+		Sync: [6]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+	}
+	// copy the target address 16 times to the wol payload
+	for i := 0; i < len(payload.Target); i++ {
+		payload.Target[i] = p.Target[i%6]
+	}
+	return payload
+}
+
+// Get bytes from struct, the SecureOn password is appended after the payload
+func (p *MagicPacket) Marshal() ([]byte, error) {
+	var buffer bytes.Buffer
+	err := binary.Write(&buffer, binary.BigEndian, p.Payload())
+	if err != nil {
+		return nil, err
+	}
+	buffer.Write(p.Password)
+	return buffer.Bytes(), nil
+}
+
+// Parse a magic packet payload
+func (p *MagicPacket) Unmarshal(b []byte) error {
+	err := Validate(b)
+	if err != nil {
+		return err
+	}
+	p.Target = make(net.HardwareAddr, 6)
+	copy(p.Target, b[6:12])
+	p.Password = nil
+	if len(b) > PayloadLen {
+		p.Password = make([]byte, len(b)-PayloadLen)
+		copy(p.Password, b[PayloadLen:])
+	}
+	return nil
+}
+
+// Checks whether b is a well-formed magic packet payload with optional password
+func Validate(b []byte) error {
+	switch len(b) {
+	case PayloadLen, PayloadLen + 4, PayloadLen + 6:
+	default:
+		return errors.New("Invalid magic packet length")
+	}
+	// sync stream
+	for i := 0; i < 6; i++ {
+		if b[i] != 0xFF {
+			return errors.New("Magic packet has no sync stream")
+		}
+	}
+	// 16 repetitions of the target address
+	for i := 12; i < PayloadLen; i++ {
+		if b[i] != b[6+i%6] {
+			return errors.New("Magic packet target repetitions differ")
+		}
+	}
+	return nil
+}
+
+// Parse a SecureOn password given as hex (a1b2c3d4) or MAC-style (a1:b2:c3:d4:e5:f6) notation
+func ParsePassword(s string) ([]byte, error) {
+	s = strings.Replace(strings.Replace(s, ":", "", -1), "-", "", -1)
+	password, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(password) != 4 && len(password) != 6 {
+		return nil, errors.New("SecureOn password must be 4 or 6 bytes long")
+	}
+	return password, nil
+}
@@ -0,0 +1,120 @@
+package wakeonlan
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestMarshalUnmarshal(t *testing.T) {
+	target, _ := net.ParseMAC("00:11:22:33:44:55")
+	password := []byte{0xa1, 0xb2, 0xc3, 0xd4}
+	p, err := NewMagicPacket(target, password)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(b) != PayloadLen+4 {
+		t.Error("Marshaled packet has invalid length")
+	}
+	if !bytes.Equal(b[:6], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Error("Sync stream is invalid")
+	}
+	if !bytes.Equal(b[96:102], target) {
+		t.Error("Last target repetition is invalid")
+	}
+	// parse it again
+	q := new(MagicPacket)
+	err = q.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !bytes.Equal(q.Target, target) || !bytes.Equal(q.Password, password) {
+		t.Error("Unmarshaled packet differs")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	target, _ := net.ParseMAC("00:11:22:33:44:55")
+	p, _ := NewMagicPacket(target, nil)
+	b, _ := p.Marshal()
+	if err := Validate(b); err != nil {
+		t.Error(err.Error())
+	}
+	if Validate(b[:PayloadLen-1]) == nil {
+		t.Error("Short packet was accepted")
+	}
+	if Validate(append(b, 0x01)) == nil {
+		t.Error("Packet with 1 byte password was accepted")
+	}
+	b[0] = 0x00
+	if Validate(b) == nil {
+		t.Error("Packet without sync stream was accepted")
+	}
+	b[0] = 0xFF
+	b[50] ^= 0xFF
+	if Validate(b) == nil {
+		t.Error("Packet with broken repetition was accepted")
+	}
+}
+
+func TestParsePassword(t *testing.T) {
+	for _, s := range []string{"a1b2c3d4", "a1:b2:c3:d4:e5:f6", "a1-b2-c3-d4"} {
+		if _, err := ParsePassword(s); err != nil {
+			t.Errorf("%s: %s", s, err.Error())
+		}
+	}
+	for _, s := range []string{"", "a1b2c3", "a1:b2:c3:d4:e5", "zz:b2:c3:d4"} {
+		if _, err := ParsePassword(s); err == nil {
+			t.Errorf("%s was accepted", s)
+		}
+	}
+}
+
+func TestNewFrame(t *testing.T) {
+	src, _ := net.ParseMAC("02:00:00:00:00:01")
+	target, _ := net.ParseMAC("00:11:22:33:44:55")
+	custom, _ := net.ParseMAC("02:00:00:00:00:02")
+	p, _ := NewMagicPacket(target, nil)
+	broadcast := []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	tests := []struct {
+		options FrameOptions
+		dst     []byte
+		tag     []byte
+	}{
+		{FrameOptions{}, broadcast, nil},
+		{FrameOptions{Unicast: true}, target, nil},
+		{FrameOptions{Destination: custom}, custom, nil},
+		{FrameOptions{VLAN: &VLANTag{ID: 42, Priority: 5}}, broadcast, []byte{0x81, 0x00, 0xa0, 0x2a}},
+		{FrameOptions{Unicast: true, VLAN: &VLANTag{ID: 4094}}, target, []byte{0x81, 0x00, 0x0f, 0xfe}},
+	}
+	for i, test := range tests {
+		b, err := NewFrame(src, p, test.options)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if len(b) != 14+len(test.tag)+PayloadLen {
+			t.Errorf("%d: Frame has invalid length", i)
+		}
+		if !bytes.Equal(b[0:6], test.dst) || !bytes.Equal(b[6:12], src) {
+			t.Errorf("%d: Frame has invalid addresses", i)
+		}
+		if !bytes.Equal(b[12:12+len(test.tag)], test.tag) {
+			t.Errorf("%d: Frame has invalid VLAN tag", i)
+		}
+		o := 12 + len(test.tag)
+		if b[o] != 0x08 || b[o+1] != 0x42 || b[o+2] != 0xFF {
+			t.Errorf("%d: Frame has invalid ether type", i)
+		}
+	}
+	// invalid tags
+	if _, err := NewFrame(src, p, FrameOptions{VLAN: &VLANTag{ID: 4095}}); err == nil {
+		t.Error("VLAN ID 4095 was accepted")
+	}
+	if _, err := NewFrame(src, p, FrameOptions{VLAN: &VLANTag{Priority: 8}}); err == nil {
+		t.Error("Priority 8 was accepted")
+	}
+}
@@ -0,0 +1,69 @@
+// +build linux
+
+package wakeonlan
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Sends magic packets as raw ethernet frames, requires CAP_NET_RAW
+type RawSender struct {
+	// Destination and VLAN tag, broadcast and untagged by default
+	Options FrameOptions
+	iface   *net.Interface
+	socket  int
+}
+
+// Constructor, opens an AF_PACKET socket for iface
+func NewRawSender(iface *net.Interface) (*RawSender, error) {
+	if len(iface.HardwareAddr) != 6 {
+		return nil, errors.New("Interface has no ethernet address")
+	}
+	socket, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(Htons(syscall.ETH_P_ALL)))
+	if err != nil {
+		return nil, err
+	}
+	return &RawSender{
+		iface:  iface,
+		socket: socket,
+	}, nil
+}
+
+// Build the complete frame for p
+func (s *RawSender) Frame(p *MagicPacket) ([]byte, error) {
+	return NewFrame(s.iface.HardwareAddr, p, s.Options)
+}
+
+// The interface frames are sent on
+func (s *RawSender) Interface() *net.Interface {
+	return s.iface
+}
+
+func (s *RawSender) Send(p *MagicPacket) error {
+	frame, err := s.Frame(p)
+	if err != nil {
+		return err
+	}
+	// set the networking interface and protocol
+	sockAddr := syscall.SockaddrLinklayer{
+		Protocol: Htons(syscall.ETH_P_ALL),
+		Ifindex:  s.iface.Index,
+	}
+	return syscall.Sendto(s.socket, frame, 0, &sockAddr)
+}
+
+func (s *RawSender) Close() error {
+	return syscall.Close(s.socket)
+}
+
+// Convert n to network byte order, AF_PACKET sockets expect the protocol that way.
+// Taken from https://github.com/xiezhenye/harp/blob/master/src/arp/arp.go#L53
+func Htons(n uint16) uint16 {
+	var (
+		high uint16 = n >> 8
+		ret  uint16 = n<<8 + high
+	)
+	return ret
+}
@@ -0,0 +1,91 @@
+package wakeonlan
+
+import (
+	"errors"
+	"net"
+	"strconv"
+)
+
+// Transport for magic packets
+type Sender interface {
+	// Send the packet once
+	Send(p *MagicPacket) error
+	// Release the underlying socket
+	Close() error
+}
+
+// Sends magic packets as UDP datagrams, no raw socket required
+type UDPSender struct {
+	conn *net.UDPConn
+}
+
+// Constructor, addr is usually a broadcast or directed broadcast address and port 7 or 9
+func NewUDPSender(addr string, port uint16) (*UDPSender, error) {
+	// resolve the (directed) broadcast address
+	raddr, err := ResolveUDPAddr("udp4", addr, nil, port)
+	if err != nil {
+		return nil, err
+	}
+	// go enables SO_BROADCAST on udp sockets by default
+	conn, err := net.DialUDP("udp4", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPSender{conn: conn}, nil
+}
+
+// Constructor for IPv6, addr is usually the all-nodes group ff02::1. Link-local
+// addresses without zone are scoped to iface.
+func NewUDP6Sender(addr string, iface *net.Interface, port uint16) (*UDPSender, error) {
+	raddr, err := ResolveUDPAddr("udp6", addr, iface, port)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp6", nil, raddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPSender{conn: conn}, nil
+}
+
+// Resolve the destination of a UDP sender without opening a socket, network is
+// udp4 or udp6. Link-local IPv6 addresses without zone are scoped to iface.
+func ResolveUDPAddr(network, addr string, iface *net.Interface, port uint16) (*net.UDPAddr, error) {
+	raddr, err := net.ResolveUDPAddr(network, net.JoinHostPort(addr, strconv.Itoa(int(port))))
+	if err != nil {
+		return nil, err
+	}
+	if network != "udp6" {
+		return raddr, nil
+	}
+	if raddr.IP.To4() != nil {
+		return nil, errors.New("Destination is no IPv6 address")
+	}
+	if raddr.Zone == "" && iface != nil && (raddr.IP.IsLinkLocalUnicast() || raddr.IP.IsLinkLocalMulticast() || raddr.IP.IsInterfaceLocalMulticast()) {
+		raddr.Zone = iface.Name
+	}
+	return raddr, nil
+}
+
+// Local address of the socket
+func (s *UDPSender) LocalAddr() *net.UDPAddr {
+	return s.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Destination of the datagrams
+func (s *UDPSender) RemoteAddr() *net.UDPAddr {
+	return s.conn.RemoteAddr().(*net.UDPAddr)
+}
+
+func (s *UDPSender) Send(p *MagicPacket) error {
+	b, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(b)
+	return err
+}
+
+func (s *UDPSender) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,81 @@
+package wakeonlan
+
+import (
+	"net"
+	"testing"
+)
+
+func TestResolveUDPAddr(t *testing.T) {
+	iface := &net.Interface{Index: 2, Name: "eth0"}
+	tests := []struct {
+		network string
+		addr    string
+		iface   *net.Interface
+		ip      string
+		zone    string
+		invalid bool
+	}{
+		// link-local addresses are scoped to the interface
+		{network: "udp6", addr: "ff02::1", iface: iface, ip: "ff02::1", zone: "eth0"},
+		{network: "udp6", addr: "fe80::1", iface: iface, ip: "fe80::1", zone: "eth0"},
+		{network: "udp6", addr: "ff01::1", iface: iface, ip: "ff01::1", zone: "eth0"},
+		// an explicit zone is kept
+		{network: "udp6", addr: "fe80::1%wlan0", iface: iface, ip: "fe80::1", zone: "wlan0"},
+		{network: "udp6", addr: "ff02::1%wlan0", iface: iface, ip: "ff02::1", zone: "wlan0"},
+		// global addresses have no zone
+		{network: "udp6", addr: "2001:db8::1", iface: iface, ip: "2001:db8::1"},
+		{network: "udp6", addr: "ff05::1", iface: iface, ip: "ff05::1"},
+		// without interface there is nothing to scope to
+		{network: "udp6", addr: "fe80::1", ip: "fe80::1"},
+		{network: "udp6", addr: "192.168.0.255", iface: iface, invalid: true},
+		{network: "udp4", addr: "192.168.0.255", iface: iface, ip: "192.168.0.255"},
+	}
+	for _, test := range tests {
+		raddr, err := ResolveUDPAddr(test.network, test.addr, test.iface, 9)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s %s was accepted", test.network, test.addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: %s", test.network, test.addr, err.Error())
+			continue
+		}
+		if !raddr.IP.Equal(net.ParseIP(test.ip)) || raddr.Zone != test.zone || raddr.Port != 9 {
+			t.Errorf("%s %s resolved to %s", test.network, test.addr, raddr)
+		}
+	}
+}
+
+func TestNewUDP6Sender(t *testing.T) {
+	// the all-nodes group needs an interface with multicast
+	var iface *net.Interface
+	ifaces, _ := net.Interfaces()
+	for i := range ifaces {
+		if ifaces[i].Flags&(net.FlagUp|net.FlagMulticast) == net.FlagUp|net.FlagMulticast {
+			iface = &ifaces[i]
+			break
+		}
+	}
+	if iface == nil {
+		t.Skip("no multicast interface")
+	}
+	for _, test := range []struct {
+		addr string
+		zone string
+	}{
+		{"ff02::1", iface.Name},
+		{"ff02::1%" + iface.Name, iface.Name},
+		{"::1", ""},
+	} {
+		s, err := NewUDP6Sender(test.addr, iface, 9)
+		if err != nil {
+			t.Skipf("no IPv6 on %s: %s", iface.Name, err.Error())
+		}
+		if s.RemoteAddr().Zone != test.zone {
+			t.Errorf("%s is sent to %s", test.addr, s.RemoteAddr())
+		}
+		s.Close()
+	}
+}
@@ -3,114 +3,327 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"flag"
 	"fmt"
+	"grnvs/pcap"
+	"grnvs/wakeonlan"
 	"net"
 	"os"
 	"path"
-	"syscall"
+	"time"
 )
 
-//the ethernet header
-type etherHeader struct {
-	DHost [6]byte
-	SHost [6]byte
-	Type  uint16
-}
-
-//wake on lan payload
-type wolPayload struct {
-	Sync   [6]byte
-	Target [96]byte
-}
-
-//complete package
-type magicPacket struct {
-	Hdr etherHeader
-	Wol wolPayload
-}
-
 func main() {
+	//subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "listen":
+			listen(os.Args[2:])
+			return
+		case "relay":
+			relay(os.Args[2:])
+			return
+		}
+	}
 	//define interface flag
 	interfaceName := flag.String("i", "eth0", "Network interface; Default is eth0")
+	//define udp transport flags
+	udp := flag.Bool("udp", false, "Send the magic packet as UDP datagram instead of a raw ethernet frame")
+	broadcastAddr := flag.String("b", "255.255.255.255", "Broadcast or directed broadcast address for -udp; Default is 255.255.255.255")
+	port := flag.Uint("p", 9, "Destination port for -udp and -udp6, usually 7 or 9; Default is 9")
+	//define ipv6 transport flags
+	udp6 := flag.Bool("udp6", false, "Send the magic packet as UDP datagram over IPv6")
+	address6 := flag.String("b6", "ff02::1", "IPv6 destination for -udp6, link-local scope is taken from -i; Default is ff02::1")
+	//define SecureOn password flag
+	passwordFlag := flag.String("pw", "", "SecureOn password, 4 or 6 bytes in hex or MAC notation")
+	//define wake-and-verify flags
+	wait := flag.Bool("wait", false, "Wait until the target shows up on the interface")
+	timeout := flag.Duration("t", 30*time.Second, "Time to wait for the target per attempt with -wait; Default is 30s")
+	retries := flag.Int("r", 3, "Number of times the packet is resent with -wait; Default is 3")
+	verifyFlag := flag.String("ip", "", "IPv4 or IPv6 address of the target, probed with ICMP echo requests during -wait")
+	//define frame addressing flags
+	dst := flag.String("dst", "broadcast", "Destination of raw frames: broadcast, unicast (to the target) or a MAC address; Default is broadcast")
+	vlan := flag.Int("vlan", -1, "Insert an 802.1Q tag with this VLAN ID 0-4094 into raw frames; Default is untagged")
+	pcp := flag.Int("pcp", 0, "802.1Q priority code point 0-7 for raw frames; Default is 0")
+	//define inventory flags
+	configFile := flag.String("c", "/etc/wol/hosts", "Host inventory with host and group definitions")
+	ethersFile := flag.String("ethers", "/etc/ethers", "Host inventory in ethers(5) format")
+	//define capture flags
+	captureFile := flag.String("w", "", "Write sent and received frames to this pcapng file")
+	dryRun := flag.Bool("dry-run", false, "Only write the frames to the -w file, no socket is opened")
 	//define error message / help
 	flag.Usage = func() {
-		fmt.Printf("Usage: %s -i <network-interface> <mac-adress>\n", path.Base(os.Args[0]))
+		fmt.Printf("Usage: %s -i <network-interface> [-pw <password>] <mac-adress>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -i <network-interface> -dst <broadcast|unicast|mac> -vlan <id> -pcp <priority> <mac-adress>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -udp -b <broadcast-address> -p <port> [-pw <password>] <mac-adress>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -udp6 -i <network-interface> -b6 <ipv6-address> -p <port> [-pw <password>] <mac-adress>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -wait -i <network-interface> -t <timeout> -r <retries> [-ip <target-ip>] <mac-adress>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s [options] <host> | @<group>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s -w <file.pcap> [-dry-run] [options] <mac-adress>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s listen -i <network-interface>\n", path.Base(os.Args[0]))
+		fmt.Printf("       %s relay -l <listen-address> -i <network-interface>[,...] -allow <file>\n", path.Base(os.Args[0]))
 	}
 	//parse command line flags
 	flag.Parse()
+	var err error
 	//validate arguments
 	if flag.NArg() != 1 {
 		flag.Usage()
 		return
 	}
-	//validate and parse the mac address
-	targetMac, err := net.ParseMAC(flag.Arg(0))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s is no valid MAC adress.\n%s", flag.Arg(0), err.Error())
+	//validate and parse the SecureOn password before any socket is opened
+	var password []byte
+	if *passwordFlag != "" {
+		password, err = wakeonlan.ParsePassword(*passwordFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s is no valid SecureOn password.\n%s\n", *passwordFlag, err.Error())
+			os.Exit(1)
+		}
+	}
+	//validate and parse the address used to verify the wake
+	var verifyIP net.IP
+	if *verifyFlag != "" {
+		verifyIP = net.ParseIP(*verifyFlag)
+		if verifyIP == nil {
+			fmt.Fprintf(os.Stderr, "%s is no valid IP address.\n", *verifyFlag)
+			os.Exit(1)
+		}
+	}
+	//validate udp port
+	if *port == 0 || *port > 0xFFFF {
+		fmt.Fprintf(os.Stderr, "%d is no valid port.\n", *port)
 		os.Exit(1)
 	}
-	//find the network interface by its name
-	networkInterface, err := net.InterfaceByName(*interfaceName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "The selected network interface %s does not exist.\n", *interfaceName)
+	//a dry run only writes the capture file
+	if *dryRun && *captureFile == "" {
+		fmt.Fprintln(os.Stderr, "-dry-run requires -w.")
+		flag.Usage()
+		os.Exit(1)
+	}
+	//validate 802.1Q vlan id, -1 is untagged
+	if *vlan < -1 || *vlan > 4094 {
+		fmt.Fprintf(os.Stderr, "%d is no valid VLAN, it must be between 0 and 4094.\n", *vlan)
+		flag.Usage()
 		os.Exit(1)
 	}
-	//create raw socket
-	socket, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(syscall.ETH_P_ALL)))
+	//validate 802.1Q priority
+	if *pcp < 0 || *pcp > 7 {
+		fmt.Fprintf(os.Stderr, "%d is no valid priority, it must be between 0 and 7.\n", *pcp)
+		flag.Usage()
+		os.Exit(1)
+	}
+	//select transport
+	transport := "raw"
+	if *udp && *udp6 {
+		fmt.Fprintln(os.Stderr, "Only one of -udp and -udp6 can be used.")
+		os.Exit(1)
+	} else if *udp {
+		transport = "udp"
+	} else if *udp6 {
+		transport = "udp6"
+	}
+	//settings from the command line
+	defaults := host{
+		Interface:   *interfaceName,
+		Password:    password,
+		Transport:   transport,
+		Broadcast:   *broadcastAddr,
+		Address6:    *address6,
+		Port:        uint16(*port),
+		IP:          verifyIP,
+		Destination: *dst,
+		VLAN:        *vlan,
+		Priority:    *pcp,
+	}
+	//the literal mac address, a host name or a @group
+	var hosts []*host
+	targetMac, err := net.ParseMAC(flag.Arg(0))
+	if err == nil {
+		hosts = []*host{newHost(flag.Arg(0), targetMac)}
+	} else {
+		inv, err := loadInventory(*ethersFile, *configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to read inventory.\n%s\n", err.Error())
+			os.Exit(1)
+		}
+		hosts, err = inv.resolve(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s is no valid MAC adress or known host.\n%s\n", flag.Arg(0), err.Error())
+			os.Exit(1)
+		}
+	}
+	//flags given on the command line take precedence over the inventory
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	for _, h := range hosts {
+		h.merge(&defaults, explicit)
+		//validate frame addressing before any socket is opened
+		if _, err := h.frameOptions(); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid frame addressing for %s.\n%s\n", h.Name, err.Error())
+			os.Exit(1)
+		}
+	}
+	//record frames
+	if *captureFile != "" {
+		f, err := openCapture(*captureFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to create %s.\n%s\n", *captureFile, err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+	}
+	//wake all hosts in parallel, the highest exit code wins
+	codes := make(chan int, len(hosts))
+	for _, h := range hosts {
+		go func(h *host) {
+			codes <- wake(h, *wait && !*dryRun, *dryRun, *timeout, *retries)
+		}(h)
+	}
+	code := 0
+	for range hosts {
+		if c := <-codes; c > code {
+			code = c
+		}
+	}
+	if code != 0 {
+		os.Exit(code)
+	}
+}
+
+//send the magic packet to h and optionally wait until it is up, returns the exit code
+func wake(h *host, wait, dryRun bool, timeout time.Duration, retries int) int {
+	//create the magic packet
+	packet, err := wakeonlan.NewMagicPacket(h.Mac, h.Password)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Unable to create socket.")
-		os.Exit(2)
-	}
-	//create a ethernet header for the wol package
-	// The ether type is taken from here https://wiki.wireshark.org/WakeOnLAN
-	header := etherHeader{
-		DHost: [6]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, //MAC Broadcast
-		Type:  0x0842,
-	}
-	//copy the mac address of the interface to the ether_header
-	copy(header.SHost[:], networkInterface.HardwareAddr[0:6])
-	//create the wol payload
-	payload := wolPayload{
-		[6]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
-		[96]byte{},
-	}
-	//copy the target address 16 times to the wol payload
-	for i := 0; i < len(payload.Target); i++ {
-		payload.Target[i] = targetMac[i%6]
-	}
-	//concat header and payload the create the whole package
-	packet := magicPacket{
-		header,
-		payload,
-	}
-	//set the networking interface and protocol
-	sockAddr := syscall.SockaddrLinklayer{
-		Protocol: htons(syscall.ETH_P_ALL),
-		Ifindex:  networkInterface.Index,
-	}
-	//encode struct
-	var buffer bytes.Buffer
-	err = binary.Write(&buffer, binary.BigEndian, packet)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", h.Name, err.Error())
+		return 1
+	}
+	//find the network interface by its name, it is needed for raw frames, udp6 and for -wait
+	var networkInterface *net.Interface
+	if h.Transport != "udp" || wait {
+		networkInterface, err = net.InterfaceByName(h.Interface)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "The selected network interface %s does not exist.\n", h.Interface)
+			return 1
+		}
+	}
+	//only record what would be sent, no socket is opened
+	if dryRun {
+		linkType, name, data, err := wireData(h, networkInterface, packet, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to encode packet for %s.\n%s\n", h.Name, err.Error())
+			return 1
+		}
+		record(linkType, name, data, pcap.Outbound)
+		return 0
+	}
+	//create the sender for the selected transport
+	var sender wakeonlan.Sender
+	switch h.Transport {
+	case "udp":
+		//send the payload via udp, no raw socket required
+		sender, err = wakeonlan.NewUDPSender(h.Broadcast, h.Port)
+	case "udp6":
+		//send the payload via udp to an ipv6 (multicast) address scoped to the interface
+		sender, err = wakeonlan.NewUDP6Sender(h.Address6, networkInterface, h.Port)
+	default:
+		var raw *wakeonlan.RawSender
+		raw, err = wakeonlan.NewRawSender(networkInterface)
+		if err == nil {
+			raw.Options, _ = h.frameOptions()
+			sender = raw
+		}
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Unable to encode packet.")
-		os.Exit(2)
+		fmt.Fprintf(os.Stderr, "Unable to create socket.\n%s\n", err.Error())
+		return 2
+	}
+	defer sender.Close()
+	//send and record the packet
+	send := func() error {
+		err := sender.Send(packet)
+		if err != nil {
+			return err
+		}
+		if capture != nil {
+			linkType, name, data, err := wireData(h, networkInterface, packet, sender)
+			if err == nil {
+				record(linkType, name, data, pcap.Outbound)
+			}
+		}
+		return nil
 	}
-	//send wol package
-	err = syscall.Sendto(socket, buffer.Bytes(), 0, &sockAddr)
+	//fire and forget
+	if !wait {
+		err = send()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to send packet to %s.\n", h.Name)
+			return 2
+		}
+		return 0
+	}
+	//start watching before the first packet leaves, so we don't miss an early answer
+	w, err := newWatcher(networkInterface, h.Mac, h.IP)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Unable to send packet.")
-		os.Exit(2)
+		fmt.Fprintf(os.Stderr, "Unable to watch interface %s.\n%s\n", networkInterface.Name, err.Error())
+		return 2
+	}
+	defer w.Close()
+	start := time.Now()
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			fmt.Printf("No sign of %s after %s, resending magic packet (%d/%d)\n", h.Name, timeout, i, retries)
+		}
+		err = send()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to send packet to %s.\n", h.Name)
+			return 2
+		}
+		if w.Wait(timeout) {
+			fmt.Printf("%s is up after %s\n", h.Name, time.Since(start))
+			return 0
+		}
 	}
+	fmt.Fprintf(os.Stderr, "%s did not wake up.\n", h.Name)
+	//exit code 3 tells scripts that the wake failed
+	return 3
 }
 
-// Taken from https://github.com/xiezhenye/harp/blob/master/src/arp/arp.go#L53
-func htons(n uint16) uint16 {
-	var (
-		high uint16 = n >> 8
-		ret  uint16 = n<<8 + high
-	)
-	return ret
+//the frame or ip packet that carries packet for h; the udp addresses are taken
+//from sender if given, otherwise the source is left unspecified
+func wireData(h *host, iface *net.Interface, packet *wakeonlan.MagicPacket, sender wakeonlan.Sender) (uint16, string, []byte, error) {
+	if h.Transport != "udp" && h.Transport != "udp6" {
+		options, err := h.frameOptions()
+		if err != nil {
+			return 0, "", nil, err
+		}
+		frame, err := wakeonlan.NewFrame(iface.HardwareAddr, packet, options)
+		return pcap.LinkTypeEthernet, iface.Name, frame, err
+	}
+	payload, err := packet.Marshal()
+	if err != nil {
+		return 0, "", nil, err
+	}
+	var local, remote *net.UDPAddr
+	if s, ok := sender.(*wakeonlan.UDPSender); ok {
+		local, remote = s.LocalAddr(), s.RemoteAddr()
+	} else {
+		if h.Transport == "udp" {
+			remote, err = wakeonlan.ResolveUDPAddr("udp4", h.Broadcast, nil, h.Port)
+		} else {
+			remote, err = wakeonlan.ResolveUDPAddr("udp6", h.Address6, iface, h.Port)
+		}
+		if err != nil {
+			return 0, "", nil, err
+		}
+		local = &net.UDPAddr{}
+	}
+	//udp datagrams leave through an interface chosen by the kernel
+	name := h.Transport
+	if iface != nil {
+		name = iface.Name
+	}
+	return pcap.LinkTypeRaw, name, udpPacket(local, remote, payload), nil
 }